@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
-	"text/template"
 	"time"
 
 	"github.com/gotd/td/session"
@@ -18,6 +21,11 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/tdakkota/tghbot/tghbot"
+	"github.com/tdakkota/tghbot/tghbot/ghapp"
+	"github.com/tdakkota/tghbot/tghbot/listener"
+	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/storage/boltstorage"
+	"github.com/tdakkota/tghbot/tghbot/storage/sqlstorage"
 )
 
 type App struct {
@@ -57,7 +65,7 @@ func (app *App) createTelegram(c *cli.Context, dispatcher tg.UpdateDispatcher, c
 		SessionStorage: &session.FileStorage{
 			Path: filepath.Join(sessionDir, "session.json"),
 		},
-		UpdateHandler: dispatcher.Handle,
+		UpdateHandler: dispatcher,
 	})
 
 	return client.Run(c.Context, func(ctx context.Context) error {
@@ -82,8 +90,22 @@ func (app *App) run(c *cli.Context) (err error) {
 	dispatcher := tg.NewUpdateDispatcher()
 	return app.createTelegram(c, dispatcher, func(c *cli.Context, client *telegram.Client) error {
 		options := tghbot.Options{
-			PollTimeout: c.Duration("bot.poll_timeout"),
-			Template:    nil,
+			PollTimeout:      c.Duration("bot.poll_timeout"),
+			MaxCatchUp:       c.Duration("bot.max_catch_up"),
+			RateLimitReserve: c.Int("bot.rate_limit_reserve"),
+			WorkflowRuns:     c.Bool("bot.workflow_runs"),
+			Template:         nil,
+		}
+		switch mode := c.String("bot.mode"); mode {
+		case "poll":
+		case "webhook":
+			options.Webhook = &tghbot.WebhookOptions{
+				Addr:   c.String("webhook.addr"),
+				Path:   c.String("webhook.path"),
+				Secret: []byte(c.String("webhook.secret")),
+			}
+		default:
+			return xerrors.Errorf("unknown mode %q", mode)
 		}
 		if c.IsSet("bot.template_path") {
 			p, err := filepath.Abs(c.Path("bot.template_path"))
@@ -91,21 +113,108 @@ func (app *App) run(c *cli.Context) (err error) {
 				return err
 			}
 			p = filepath.Join(p, "*")
-			options.Template, err = template.ParseGlob(p)
+			options.Template, err = template.New("").Funcs(tghbot.TemplateFuncs()).ParseGlob(p)
 			if err != nil {
 				return err
 			}
 		}
 
-		app.bot = tghbot.NewBot(options, client, oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: c.String("gh.token")},
-		), tghbot.WithLogger(app.logger))
+		store, err := app.createStorage(c)
+		if err != nil {
+			return xerrors.Errorf("failed to create storage: %w", err)
+		}
+		defer func() {
+			if closer, ok := store.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}()
+
+		clients, hosts, err := app.createGithubClients(c)
+		if err != nil {
+			return xerrors.Errorf("failed to create Github client: %w", err)
+		}
+		options.Hosts = hosts
+
+		app.bot = tghbot.NewBot(options, client, clients, tghbot.WithLogger(app.logger), tghbot.WithStorage(store))
 		app.bot.SetupDispatcher(dispatcher)
 
 		return app.bot.Run(c.Context)
 	})
 }
 
+// createGithubClients creates Github clients and returns list of configured Github Enterprise Server hosts.
+func (app *App) createGithubClients(c *cli.Context) (listener.Clients, []string, error) {
+	hosts := map[string]listener.Clients{}
+	var enterpriseHosts []string
+
+	if c.IsSet("gh.enterprise_url") {
+		baseURL := c.String("gh.enterprise_url")
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Host == "" {
+			return nil, nil, xerrors.Errorf("invalid Github Enterprise URL %q", baseURL)
+		}
+		if c.String("gh.enterprise_token") == "" {
+			return nil, nil, xerrors.New("Github Enterprise token must be set")
+		}
+
+		uploadURL := baseURL
+		if c.IsSet("gh.enterprise_upload_url") {
+			uploadURL = c.String("gh.enterprise_upload_url")
+		}
+		clients, err := tghbot.EnterpriseTokenClients(baseURL, uploadURL, oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: c.String("gh.enterprise_token")},
+		))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		host := storage.NormalizeHost(u.Host)
+		hosts[host] = clients
+		enterpriseHosts = append(enterpriseHosts, host)
+	}
+
+	switch {
+	case c.IsSet("gh.app_id"):
+		data, err := ioutil.ReadFile(c.Path("gh.app_private_key"))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to read private key: %w", err)
+		}
+		key, err := ghapp.ParsePrivateKey(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		gh, err := ghapp.New(c.Int64("gh.app_id"), key)
+		if err != nil {
+			return nil, nil, err
+		}
+		hosts[""] = gh
+	case c.String("gh.token") != "":
+		hosts[""] = tghbot.TokenClients(oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: c.String("gh.token")},
+		))
+	case len(hosts) == 0:
+		return nil, nil, xerrors.New("either Github token or Github App ID and private key must be set")
+	}
+
+	return listener.HostClients(hosts), enterpriseHosts, nil
+}
+
+func (app *App) createStorage(c *cli.Context) (storage.Storage, error) {
+	switch typ := c.String("storage.type"); typ {
+	case "memory":
+		return storage.NewInMemoryStorage(), nil
+	case "bolt":
+		return boltstorage.Open(c.Path("storage.path"))
+	case "sqlite":
+		return sqlstorage.Open(c.Context, sqlstorage.SQLite, c.String("storage.dsn"))
+	case "postgres":
+		return sqlstorage.Open(c.Context, sqlstorage.Postgres, c.String("storage.dsn"))
+	default:
+		return nil, xerrors.Errorf("unknown storage type %q", typ)
+	}
+}
+
 func (app *App) getEnvNames(names ...string) []string {
 	return names
 }
@@ -120,25 +229,100 @@ func (app *App) flags() []cli.Flag {
 		},
 
 		// bot
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "bot.mode",
+			Value:   "poll",
+			Usage:   "Github events source: poll (events API) or webhook",
+			Aliases: []string{"mode"},
+			EnvVars: app.getEnvNames("MODE"),
+		}),
 		altsrc.NewDurationFlag(&cli.DurationFlag{
 			Name:    "bot.poll_timeout",
 			Value:   10 * time.Second,
 			Usage:   "Github Events API polling timeout",
 			Aliases: []string{"poll_timeout"},
 		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "bot.max_catch_up",
+			Value:   24 * time.Hour,
+			Usage:   "Maximum age of events delivered after restart, zero means no limit",
+			Aliases: []string{"max_catch_up"},
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "bot.rate_limit_reserve",
+			Value:   100,
+			Usage:   "Number of Github API requests kept in reserve, polling is paused when budget is lower",
+			Aliases: []string{"rate_limit_reserve"},
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    "bot.workflow_runs",
+			Usage:   "Poll failed Github Actions workflow runs, costs one more API request per repository poll",
+			Aliases: []string{"workflow_runs"},
+		}),
 		altsrc.NewPathFlag(&cli.PathFlag{
 			Name:    "bot.template_path",
 			Usage:   "Messages templates path",
 			Aliases: []string{"template_path"},
 		}),
 
+		// webhook
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "webhook.addr",
+			Value:   ":8080",
+			Usage:   "Webhook receiver listen address",
+			Aliases: []string{"webhook_addr"},
+			EnvVars: app.getEnvNames("WEBHOOK_ADDR"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "webhook.path",
+			Value:   "/webhook",
+			Usage:   "Webhook receiver URL path",
+			Aliases: []string{"webhook_path"},
+			EnvVars: app.getEnvNames("WEBHOOK_PATH"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "webhook.secret",
+			Usage:   "Github webhook secret",
+			Aliases: []string{"webhook_secret"},
+			EnvVars: app.getEnvNames("WEBHOOK_SECRET"),
+		}),
+
 		// gh
 		altsrc.NewStringFlag(&cli.StringFlag{
-			Name:     "gh.token",
-			Required: true,
-			Usage:    "Github API token",
-			Aliases:  []string{"gh_token"},
-			EnvVars:  app.getEnvNames("GITHUB_TOKEN"),
+			Name:    "gh.token",
+			Usage:   "Github API token",
+			Aliases: []string{"gh_token"},
+			EnvVars: app.getEnvNames("GITHUB_TOKEN"),
+		}),
+		altsrc.NewInt64Flag(&cli.Int64Flag{
+			Name:    "gh.app_id",
+			Usage:   "Github App ID, used instead of Github API token",
+			Aliases: []string{"gh_app_id"},
+			EnvVars: app.getEnvNames("GITHUB_APP_ID"),
+		}),
+		altsrc.NewPathFlag(&cli.PathFlag{
+			Name:    "gh.app_private_key",
+			Usage:   "Github App private key path",
+			Aliases: []string{"gh_app_private_key"},
+			EnvVars: app.getEnvNames("GITHUB_APP_PRIVATE_KEY"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "gh.enterprise_url",
+			Usage:   "Github Enterprise Server API base URL, e.g. https://ghes.example.com/api/v3/",
+			Aliases: []string{"gh_enterprise_url"},
+			EnvVars: app.getEnvNames("GITHUB_ENTERPRISE_URL"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "gh.enterprise_upload_url",
+			Usage:   "Github Enterprise Server upload URL, defaults to API base URL",
+			Aliases: []string{"gh_enterprise_upload_url"},
+			EnvVars: app.getEnvNames("GITHUB_ENTERPRISE_UPLOAD_URL"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "gh.enterprise_token",
+			Usage:   "Github Enterprise Server API token",
+			Aliases: []string{"gh_enterprise_token"},
+			EnvVars: app.getEnvNames("GITHUB_ENTERPRISE_TOKEN"),
 		}),
 
 		// tg
@@ -169,6 +353,28 @@ func (app *App) flags() []cli.Flag {
 			Aliases: []string{"session_dir"},
 			EnvVars: app.getEnvNames("SESSION_DIR"),
 		}),
+
+		// storage
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "storage.type",
+			Value:   "bolt",
+			Usage:   "Subscriptions storage type (memory, bolt, sqlite, postgres)",
+			Aliases: []string{"storage_type"},
+			EnvVars: app.getEnvNames("STORAGE_TYPE"),
+		}),
+		altsrc.NewPathFlag(&cli.PathFlag{
+			Name:    "storage.path",
+			Value:   "tghbot.db",
+			Usage:   "BoltDB database path",
+			Aliases: []string{"storage_path"},
+			EnvVars: app.getEnvNames("STORAGE_PATH"),
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "storage.dsn",
+			Usage:   "SQL database DSN (for sqlite and postgres storage types)",
+			Aliases: []string{"storage_dsn"},
+			EnvVars: app.getEnvNames("STORAGE_DSN", "DATABASE_URL"),
+		}),
 	}
 
 	return flags
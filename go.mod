@@ -3,12 +3,16 @@ module github.com/tdakkota/tghbot
 go 1.15
 
 require (
+	github.com/cenkalti/backoff/v4 v4.1.0
 	github.com/google/go-github/v33 v33.0.0
 	github.com/gotd/td v0.31.1
-	github.com/gregjones/httpcache v0.0.0-20190611155906-901d90724c79
+	github.com/lib/pq v1.9.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli/v2 v2.3.0
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.16.0
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
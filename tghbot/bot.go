@@ -2,24 +2,31 @@ package tghbot
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/google/go-github/v33/github"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
-	"github.com/gregjones/httpcache"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/oauth2"
 
 	"github.com/tdakkota/tghbot/tghbot/listener"
 	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/tgutil"
 )
 
 type Bot struct {
 	tg      *telegram.Client
 	storage storage.Storage
+	cursors storage.CursorStorage
+	seen    storage.SeenStorage
+	peers   storage.PeerStorage
 	subs    listener.Listener
+	clients listener.Clients
+
+	resolver *tgutil.Resolver
 
 	options Options
 	log     *zap.Logger
@@ -31,6 +38,30 @@ func WithStorage(storage storage.Storage) func(*Bot) {
 	}
 }
 
+// WithCursorStorage sets storage of repository event cursors.
+// If not set, storage is used if it implements storage.CursorStorage.
+func WithCursorStorage(cursors storage.CursorStorage) func(*Bot) {
+	return func(bot *Bot) {
+		bot.cursors = cursors
+	}
+}
+
+// WithSeenStorage sets storage of delivered events.
+// If not set, storage is used if it implements storage.SeenStorage.
+func WithSeenStorage(seen storage.SeenStorage) func(*Bot) {
+	return func(bot *Bot) {
+		bot.seen = seen
+	}
+}
+
+// WithPeerStorage sets storage of Telegram peer access hashes.
+// If not set, storage is used if it implements storage.PeerStorage.
+func WithPeerStorage(peers storage.PeerStorage) func(*Bot) {
+	return func(bot *Bot) {
+		bot.peers = peers
+	}
+}
+
 func WithLogger(log *zap.Logger) func(*Bot) {
 	return func(bot *Bot) {
 		bot.log = log
@@ -45,21 +76,34 @@ func createGithubClient(src oauth2.TokenSource) *github.Client {
 		Source: src,
 	}
 
-	// Memory caching.
-	transport = &httpcache.Transport{
-		Transport:           transport,
-		Cache:               httpcache.NewMemoryCache(),
-		MarkCachedResponses: true,
-	}
-
 	return github.NewClient(&http.Client{Transport: transport})
 }
 
-func NewBot(options Options, tg *telegram.Client, src oauth2.TokenSource, opts ...func(*Bot)) *Bot {
+// TokenClients returns Github clients which use given token source, e.g. personal access token.
+func TokenClients(src oauth2.TokenSource) listener.Clients {
+	return listener.StaticClient(createGithubClient(src))
+}
+
+// EnterpriseTokenClients returns Github Enterprise Server clients which use given token source.
+func EnterpriseTokenClients(baseURL, uploadURL string, src oauth2.TokenSource) (listener.Clients, error) {
+	gh, err := github.NewEnterpriseClient(baseURL, uploadURL, &http.Client{
+		Transport: &oauth2.Transport{Source: src},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create enterprise client: %w", err)
+	}
+	return listener.StaticClient(gh), nil
+}
+
+// NewBot creates new Bot.
+// Github clients may be created using TokenClients or ghapp.New for Github App authentication.
+// Use listener.HostClients to follow both github.com and Github Enterprise Server repositories.
+func NewBot(options Options, client *telegram.Client, clients listener.Clients, opts ...func(*Bot)) *Bot {
 	options.ParseTemplates()
 
 	b := &Bot{
-		tg:      tg,
+		tg:      client,
+		clients: clients,
 		options: options,
 	}
 
@@ -69,15 +113,39 @@ func NewBot(options Options, tg *telegram.Client, src oauth2.TokenSource, opts .
 	if b.storage == nil {
 		b.storage = storage.NewInMemoryStorage()
 	}
+	if b.cursors == nil {
+		if cursors, ok := b.storage.(storage.CursorStorage); ok {
+			b.cursors = cursors
+		}
+	}
+	if b.seen == nil {
+		if seen, ok := b.storage.(storage.SeenStorage); ok {
+			b.seen = seen
+		}
+	}
+	if b.peers == nil {
+		peers, ok := b.storage.(storage.PeerStorage)
+		if !ok {
+			peers = storage.NewInMemoryStorage()
+		}
+		b.peers = peers
+	}
+	b.resolver = tgutil.NewResolver(tg.NewClient(client), b.peers)
 	if b.log == nil {
 		b.log, _ = zap.NewDevelopment(zap.IncreaseLevel(zapcore.DebugLevel))
 	}
 
 	b.subs = listener.NewListener(
-		createGithubClient(src),
+		clients,
 		b.storage,
 		b.eventHandler,
 		listener.WithLogger(b.log),
+		listener.WithPollTimeout(options.PollTimeout),
+		listener.WithCursorStorage(b.cursors),
+		listener.WithSeenStorage(b.seen),
+		listener.WithMaxCatchUp(options.MaxCatchUp),
+		listener.WithRateLimitReserve(options.RateLimitReserve),
+		listener.WithWorkflowRuns(options.WorkflowRuns),
 	)
 
 	return b
@@ -93,15 +161,23 @@ func (b *Bot) Run(ctx context.Context) error {
 		b.log.Warn("expected that current user is bot")
 	}
 
+	if b.options.Webhook != nil {
+		return b.runWebhook(ctx, *b.options.Webhook)
+	}
 	return b.subs.Run(ctx)
 }
 
 func (b *Bot) SetupDispatcher(dispatcher tg.UpdateDispatcher) {
-	dispatcher.OnNewMessage(func(ctx tg.UpdateContext, update *tg.UpdateNewMessage) error {
-		return b.handleMessage(b.wrapContext(ctx), update)
+	dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
+		return b.handleMessage(b.wrapContext(ctx, e), update)
+	})
+
+	// Messages of supergroups and channel posts.
+	dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
+		return b.handleChannelMessage(b.wrapContext(ctx, e), update)
 	})
 
-	dispatcher.OnBotInlineQuery(func(ctx tg.UpdateContext, update *tg.UpdateBotInlineQuery) error {
-		return b.handleInlineQuery(b.wrapContext(ctx), update)
+	dispatcher.OnBotInlineQuery(func(ctx context.Context, e tg.Entities, update *tg.UpdateBotInlineQuery) error {
+		return b.handleInlineQuery(b.wrapContext(ctx, e), update)
 	})
 }
@@ -2,48 +2,46 @@ package tghbot
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/gotd/td/tg"
 	"github.com/tdakkota/tghbot/tghbot/listener"
+	"github.com/tdakkota/tghbot/tghbot/markup"
 	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/tgutil"
 )
 
 func (b *Bot) eventHandler(ctx context.Context, e listener.Event) error {
 	return b.sendTemplate(ctx, e.Mapping.Peer, e.Type, e.Payload)
 }
 
-var errInvalidPeerType = errors.New("invalid peer type")
-
+// sendTemplate sends message rendered from template to the peer.
+// Errors which will not disappear on retry are marked using listener.Permanent.
 func (b *Bot) sendTemplate(ctx context.Context, peer storage.Peer, tmplName string, payload listener.Payload) error {
 	data := payload.Data
 
 	var s strings.Builder
 	err := b.options.Template.ExecuteTemplate(&s, tmplName, data)
 	if err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		return listener.Permanent(fmt.Errorf("failed to execute template: %w", err))
 	}
 
-	var inputPeer tg.InputPeerClass
-	switch peer.PeerType {
-	case storage.Channel:
-		inputPeer = &tg.InputPeerChannel{
-			ChannelID:  peer.ID,
-			AccessHash: peer.AccessHash,
-		}
-	case storage.User:
-		inputPeer = &tg.InputPeerUser{
-			UserID:     peer.ID,
-			AccessHash: peer.AccessHash,
-		}
-	case storage.Chat:
-		inputPeer = &tg.InputPeerChat{
-			ChatID: peer.ID,
-		}
-	default:
-		return errInvalidPeerType
+	// Templates produce Telegram HTML subset, Github text is escaped by html/template.
+	text, entities, err := markup.HTML(s.String())
+	if err != nil {
+		return listener.Permanent(fmt.Errorf("failed to parse message: %w", err))
+	}
+	// Github bodies are not limited, long message would be rejected as MESSAGE_TOO_LONG.
+	text, entities = markup.Truncate(text, entities, markup.MessageLimit)
+
+	resolved, err := b.resolver.Resolve(ctx, peer)
+	if err != nil {
+		return err
+	}
+	inputPeer, err := tgutil.ConvertPeerToInputPeer(resolved)
+	if err != nil {
+		return err
 	}
 
 	randomID, err := b.tg.RandInt64()
@@ -54,7 +52,10 @@ func (b *Bot) sendTemplate(ctx context.Context, peer storage.Peer, tmplName stri
 	msg := &tg.MessagesSendMessageRequest{
 		Peer:     inputPeer,
 		RandomID: randomID,
-		Message:  s.String(),
+		Message:  text,
+	}
+	if len(entities) > 0 {
+		msg.SetEntities(entities)
 	}
 
 	if len(payload.Links) > 0 {
@@ -62,7 +63,7 @@ func (b *Bot) sendTemplate(ctx context.Context, peer storage.Peer, tmplName stri
 		for _, link := range payload.Links {
 			rply.Rows = append(rply.Rows, tg.KeyboardButtonRow{
 				Buttons: []tg.KeyboardButtonClass{
-					&tg.KeyboardButtonUrl{
+					&tg.KeyboardButtonURL{
 						Text: link.Name,
 						URL:  link.URL,
 					},
@@ -73,6 +74,20 @@ func (b *Bot) sendTemplate(ctx context.Context, peer storage.Peer, tmplName stri
 	}
 
 	err = b.tg.SendMessage(ctx, msg)
+	if tgutil.IsPeerInvalid(err) {
+		// Access hash may be changed or not known yet, retry once with refreshed one.
+		resolved, resolveErr := b.resolver.Refresh(ctx, resolved)
+		if resolveErr != nil {
+			return fmt.Errorf("failed to send message: %w (refresh peer: %v)", err, resolveErr)
+		}
+		if msg.Peer, err = tgutil.ConvertPeerToInputPeer(resolved); err != nil {
+			return err
+		}
+		err = b.tg.SendMessage(ctx, msg)
+	}
+	if tgutil.IsPermanent(err) {
+		return listener.Permanent(fmt.Errorf("failed to send message: %w", err))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
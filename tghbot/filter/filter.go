@@ -0,0 +1,307 @@
+// Package filter implements subscription filter expressions.
+//
+// Expression consists of conditions combined with "and", "or", "not" and parentheses.
+// Adjacent conditions are combined with "and". Conditions are:
+//
+//	label:<glob>   event has matching label
+//	author:<glob>  event author login matches
+//	path:<glob>    event changes matching file
+//	draft[:bool]   pull request is draft
+//
+// Values may be quoted, e.g. label:"good first issue".
+// Labels and logins are matched case-insensitively.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tdakkota/tghbot/tghbot/glob"
+)
+
+// Subject is a set of event properties matched by filter.
+type Subject struct {
+	Labels []string
+	Author string
+	Draft  bool
+	// Paths returns paths of changed files. It is called only if filter
+	// contains path conditions, at most once. May be nil.
+	Paths func() ([]string, error)
+}
+
+// Filter is a parsed filter expression.
+type Filter struct {
+	expr string
+	root node
+}
+
+// Parse parses filter expression.
+func Parse(expr string) (*Filter, error) {
+	p := &parser{tokens: tokenize(expr)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match whether subject matches filter.
+func (f *Filter) Match(s Subject) (bool, error) {
+	return f.root.eval(&subject{Subject: s})
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// subject caches lazily loaded paths.
+type subject struct {
+	Subject
+	paths  []string
+	loaded bool
+}
+
+func (s *subject) changedPaths() ([]string, error) {
+	if s.loaded || s.Paths == nil {
+		return s.paths, nil
+	}
+
+	paths, err := s.Paths()
+	if err != nil {
+		return nil, fmt.Errorf("get changed paths: %w", err)
+	}
+	s.paths, s.loaded = paths, true
+	return paths, nil
+}
+
+type node interface {
+	eval(s *subject) (bool, error)
+}
+
+type (
+	andNode struct{ left, right node }
+	orNode  struct{ left, right node }
+	notNode struct{ node node }
+	// condNode is a single condition, e.g. label:bug.
+	condNode struct {
+		key   string
+		value string
+	}
+)
+
+func (n andNode) eval(s *subject) (bool, error) {
+	ok, err := n.left.eval(s)
+	if err != nil || !ok {
+		return false, err
+	}
+	return n.right.eval(s)
+}
+
+func (n orNode) eval(s *subject) (bool, error) {
+	ok, err := n.left.eval(s)
+	if err != nil || ok {
+		return ok, err
+	}
+	return n.right.eval(s)
+}
+
+func (n notNode) eval(s *subject) (bool, error) {
+	ok, err := n.node.eval(s)
+	return !ok, err
+}
+
+func (n condNode) eval(s *subject) (bool, error) {
+	switch n.key {
+	case "label":
+		return matchAny(strings.ToLower(n.value), s.Labels, strings.ToLower), nil
+	case "author":
+		return glob.Match(strings.ToLower(n.value), strings.ToLower(s.Author)), nil
+	case "path":
+		paths, err := s.changedPaths()
+		if err != nil {
+			return false, err
+		}
+		return matchAny(n.value, paths, nil), nil
+	case "draft":
+		want, _ := strconv.ParseBool(n.value)
+		return s.Draft == want, nil
+	default:
+		return false, fmt.Errorf("unknown condition %q", n.key)
+	}
+}
+
+func matchAny(pattern string, values []string, normalize func(string) string) bool {
+	re := glob.Compile(pattern)
+	for _, v := range values {
+		if normalize != nil {
+			v = normalize(v)
+		}
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits expression into parentheses and words.
+// Quoted parts of words may contain spaces and parentheses, quotes are removed.
+func tokenize(expr string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+		inWord bool
+		quoted bool
+	)
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for _, c := range expr {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case quoted:
+			word.WriteRune(c)
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (string, bool) {
+	tok, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return tok, ok
+}
+
+func isKeyword(tok, keyword string) bool {
+	return strings.EqualFold(tok, keyword)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || !isKeyword(tok, "or") {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok == ")" || isKeyword(tok, "or") {
+			return left, nil
+		}
+		if isKeyword(tok, "and") {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok, ok := p.next()
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case isKeyword(tok, "not"):
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: n}, nil
+	case tok == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.next(); !ok || tok != ")" {
+			return nil, fmt.Errorf("expected %q", ")")
+		}
+		return n, nil
+	default:
+		return parseCond(tok)
+	}
+}
+
+func parseCond(tok string) (node, error) {
+	key, value := tok, ""
+	if i := strings.IndexByte(tok, ':'); i >= 0 {
+		key, value = tok[:i], tok[i+1:]
+	}
+	key = strings.ToLower(key)
+
+	switch key {
+	case "label", "author", "path":
+		if value == "" {
+			return nil, fmt.Errorf("empty value of %q", key)
+		}
+	case "draft":
+		if value == "" {
+			value = "true"
+		}
+		if _, err := strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid draft value %q", value)
+		}
+	default:
+		return nil, fmt.Errorf("unknown condition %q", tok)
+	}
+
+	return condNode{key: key, value: value}, nil
+}
@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	subject := Subject{
+		Labels: []string{"Bug", "good first issue"},
+		Author: "tdakkota",
+		Draft:  false,
+	}
+	for _, tt := range []struct {
+		expr  string
+		match bool
+	}{
+		{"label:bug", true},
+		{"label:feature", false},
+		{`label:"good first issue"`, true},
+		{"label:good*", true},
+		{"author:tdakkota", true},
+		{"author:dependabot*", false},
+		{"not author:dependabot*", true},
+		{"label:bug and author:tdakkota", true},
+		{"label:bug author:other", false},
+		{"label:feature or author:tdakkota", true},
+		{"not (label:feature or label:bug)", false},
+		{"draft", false},
+		{"draft:false", true},
+		{"path:docs/**", false},
+	} {
+		f, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+
+		match, err := f.Match(subject)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, tt.match, match, tt.expr)
+	}
+}
+
+func TestFilterPaths(t *testing.T) {
+	a := require.New(t)
+
+	calls := 0
+	subject := Subject{
+		Author: "user",
+		Paths: func() ([]string, error) {
+			calls++
+			return []string{"docs/guide/index.md", "main.go"}, nil
+		},
+	}
+
+	f, err := Parse("author:other or path:docs/** and path:*.go")
+	a.NoError(err)
+	match, err := f.Match(subject)
+	a.NoError(err)
+	a.True(match)
+	a.Equal(1, calls)
+
+	// Paths are not loaded if not needed.
+	f, err = Parse("author:other and path:docs/**")
+	a.NoError(err)
+	match, err = f.Match(subject)
+	a.NoError(err)
+	a.False(match)
+	a.Equal(1, calls)
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"label:",
+		"unknown:x",
+		"(label:bug",
+		"label:bug)",
+		"not",
+		"draft:maybe",
+		"label:bug or",
+	} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+}
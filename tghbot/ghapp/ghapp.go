@@ -0,0 +1,196 @@
+// Package ghapp implements Github App authentication.
+package ghapp
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"golang.org/x/oauth2"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+const (
+	// jwtTTL is a lifetime of app JWT, Github allows at most 10 minutes.
+	jwtTTL = 9 * time.Minute
+	// tokenTimeout is a timeout of installation token request.
+	tokenTimeout = 30 * time.Second
+)
+
+// App authenticates as Github App and provides installation clients
+// for repositories. It implements listener.Clients.
+type App struct {
+	id  int64
+	key *rsa.PrivateKey
+
+	transport http.RoundTripper
+	// newClient creates Github client from HTTP client.
+	newClient func(*http.Client) (*github.Client, error)
+	// app is a client authenticated as app itself.
+	app *github.Client
+
+	installations map[storage.Repo]int64
+	clients       map[int64]*github.Client
+	mux           sync.Mutex
+}
+
+// WithTransport sets base HTTP transport.
+func WithTransport(transport http.RoundTripper) func(*App) {
+	return func(app *App) {
+		app.transport = transport
+	}
+}
+
+// WithClientFactory sets Github client constructor, e.g. to use Github Enterprise API URL.
+func WithClientFactory(f func(*http.Client) (*github.Client, error)) func(*App) {
+	return func(app *App) {
+		app.newClient = f
+	}
+}
+
+// New creates new App.
+func New(id int64, key *rsa.PrivateKey, opts ...func(*App)) (*App, error) {
+	a := &App{
+		id:            id,
+		key:           key,
+		installations: map[storage.Repo]int64{},
+		clients:       map[int64]*github.Client{},
+	}
+
+	for _, op := range opts {
+		op(a)
+	}
+	if a.transport == nil {
+		a.transport = http.DefaultTransport
+	}
+	if a.newClient == nil {
+		a.newClient = func(client *http.Client) (*github.Client, error) {
+			return github.NewClient(client), nil
+		}
+	}
+
+	var err error
+	a.app, err = a.newClient(&http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.ReuseTokenSource(nil, jwtSource{app: a}),
+		Base:   a.transport,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// jwtSource is a token source of app JWT.
+type jwtSource struct {
+	app *App
+}
+
+func (s jwtSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	jwt, err := signJWT(s.app.id, s.app.key, now, jwtTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: jwt,
+		TokenType:   "Bearer",
+		// Refresh token before expiration.
+		Expiry: now.Add(jwtTTL - time.Minute),
+	}, nil
+}
+
+// installationSource is a token source of installation access tokens.
+type installationSource struct {
+	app *App
+	id  int64
+}
+
+func (s installationSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTimeout)
+	defer cancel()
+
+	tok, resp, err := s.app.app.Apps.CreateInstallationToken(ctx, s.id, nil)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized) {
+		// Installation is removed or app is reinstalled with another ID, so find it again.
+		s.app.evict(s.id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation %d token: %w", s.id, err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: tok.GetToken(),
+		TokenType:   "Bearer",
+		// Refresh token before expiration.
+		Expiry: tok.GetExpiresAt().Add(-time.Minute),
+	}, nil
+}
+
+// findInstallation finds app installation of repository or, if repo denotes owner,
+// of organization or user.
+func (a *App) findInstallation(ctx context.Context, repo storage.Repo) (*github.Installation, error) {
+	if !repo.IsOwner() {
+		installation, _, err := a.app.Apps.FindRepositoryInstallation(ctx, repo.Owner, repo.Name)
+		return installation, err
+	}
+
+	installation, resp, err := a.app.Apps.FindOrganizationInstallation(ctx, repo.Owner)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		installation, _, err = a.app.Apps.FindUserInstallation(ctx, repo.Owner)
+	}
+	return installation, err
+}
+
+// evict removes cached installation and its client.
+func (a *App) evict(id int64) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	for repo, installation := range a.installations {
+		if installation == id {
+			delete(a.installations, repo)
+		}
+	}
+	delete(a.clients, id)
+}
+
+// Client returns client authenticated as app installation which has access to given repository.
+func (a *App) Client(ctx context.Context, repo storage.Repo) (*github.Client, error) {
+	a.mux.Lock()
+	id, ok := a.installations[repo]
+	a.mux.Unlock()
+
+	if !ok {
+		installation, err := a.findInstallation(ctx, repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find installation of %s: %w", repo.ToGithubURL(), err)
+		}
+		id = installation.GetID()
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.installations[repo] = id
+	if client, ok := a.clients[id]; ok {
+		return client, nil
+	}
+
+	client, err := a.newClient(&http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.ReuseTokenSource(nil, installationSource{app: a, id: id}),
+		Base:   a.transport,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	a.clients[id] = client
+
+	return client, nil
+}
@@ -0,0 +1,148 @@
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func verifyJWT(t *testing.T, key *rsa.PublicKey, token string) {
+	t.Helper()
+	a := require.New(t)
+
+	parts := strings.Split(token, ".")
+	a.Len(parts, 3)
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	a.NoError(err)
+	a.NoError(rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig))
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	a.NoError(err)
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	a.NoError(json.Unmarshal(data, &claims))
+	a.Equal("42", claims.Issuer)
+	a.True(claims.ExpiresAt > time.Now().Unix())
+	a.True(claims.ExpiresAt-claims.IssuedAt <= 10*60)
+}
+
+func TestApp(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+
+	tokenRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/gotd/td/installation", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	})
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		verifyJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		tokenRequests++
+		expiresAt := time.Now().Add(time.Hour)
+		_ = json.NewEncoder(w).Encode(github.InstallationToken{
+			Token:     github.String("installation-token"),
+			ExpiresAt: &expiresAt,
+		})
+	})
+	mux.HandleFunc("/repos/gotd/td/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer installation-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	app, err := New(42, key, WithClientFactory(func(client *http.Client) (*github.Client, error) {
+		gh := github.NewClient(client)
+		gh.BaseURL, _ = url.Parse(srv.URL + "/")
+		return gh, nil
+	}))
+	a.NoError(err)
+
+	repo := storage.Repo{Owner: "gotd", Name: "td"}
+	for i := 0; i < 2; i++ {
+		client, err := app.Client(ctx, repo)
+		a.NoError(err)
+
+		_, _, err = client.Activity.ListRepositoryEvents(ctx, repo.Owner, repo.Name, nil)
+		a.NoError(err)
+	}
+	// Token must be reused.
+	a.Equal(1, tokenRequests)
+}
+
+func TestAppReinstall(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+
+	// App is reinstalled, so installation 1 is removed and 2 is created.
+	installation := 1
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/gotd/td/installation", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.Installation{ID: github.Int64(int64(installation))})
+	})
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/app/installations/2/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		expiresAt := time.Now().Add(time.Hour)
+		_ = json.NewEncoder(w).Encode(github.InstallationToken{
+			Token:     github.String("installation-token"),
+			ExpiresAt: &expiresAt,
+		})
+	})
+	mux.HandleFunc("/repos/gotd/td/events", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	app, err := New(42, key, WithClientFactory(func(client *http.Client) (*github.Client, error) {
+		gh := github.NewClient(client)
+		gh.BaseURL, _ = url.Parse(srv.URL + "/")
+		return gh, nil
+	}))
+	a.NoError(err)
+
+	repo := storage.Repo{Owner: "gotd", Name: "td"}
+	client, err := app.Client(ctx, repo)
+	a.NoError(err)
+	installation = 2
+	_, _, err = client.Activity.ListRepositoryEvents(ctx, repo.Owner, repo.Name, nil)
+	a.Error(err)
+
+	// Cached installation is evicted after failed token request.
+	client, err = app.Client(ctx, repo)
+	a.NoError(err)
+	_, _, err = client.Activity.ListRepositoryEvents(ctx, repo.Owner, repo.Name, nil)
+	a.NoError(err)
+}
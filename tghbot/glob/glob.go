@@ -0,0 +1,39 @@
+// Package glob implements glob patterns used by subscription filters.
+package glob
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Compile converts glob pattern to regular expression.
+// "*" matches any characters except "/", "**" matches any characters and "?" matches single character.
+func Compile(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Match whether s matches glob pattern.
+func Match(pattern, s string) bool {
+	return Compile(pattern).MatchString(s)
+}
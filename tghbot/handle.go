@@ -1,6 +1,8 @@
 package tghbot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -8,11 +10,14 @@ import (
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 
+	"github.com/tdakkota/tghbot/tghbot/filter"
 	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/tgutil"
 )
 
 type updateContext struct {
-	tg.UpdateContext
+	context.Context
+	tg.Entities
 	*telegram.Client
 	peer   tg.InputPeerClass
 	fields []zap.Field
@@ -27,10 +32,11 @@ func (u updateContext) Answer(m *tg.MessagesSendMessageRequest) (err error) {
 	return u.Client.SendMessage(u, m)
 }
 
-func (b *Bot) wrapContext(uctx tg.UpdateContext) updateContext {
+func (b *Bot) wrapContext(uctx context.Context, e tg.Entities) updateContext {
 	ctx := updateContext{
-		UpdateContext: uctx,
-		Client:        b.tg,
+		Context:  uctx,
+		Entities: e,
+		Client:   b.tg,
 	}
 	return ctx
 }
@@ -41,51 +47,48 @@ func (b *Bot) handleInlineQuery(ctx updateContext, u *tg.UpdateBotInlineQuery) e
 }
 
 func (b *Bot) handleMessage(ctx updateContext, u *tg.UpdateNewMessage) error {
-	ctx.fields = append(ctx.fields, zap.String("message_type", fmt.Sprintf("%T", u.Message)))
-	msg, ok := u.Message.(*tg.Message)
-	if !ok {
+	return b.handleMessageClass(ctx, u.Message)
+}
+
+func (b *Bot) handleChannelMessage(ctx updateContext, u *tg.UpdateNewChannelMessage) error {
+	return b.handleMessageClass(ctx, u.Message)
+}
+
+func (b *Bot) handleMessageClass(ctx updateContext, m tg.MessageClass) error {
+	ctx.fields = append(ctx.fields, zap.String("message_type", fmt.Sprintf("%T", m)))
+	msg, ok := m.(*tg.Message)
+	if !ok || msg.Out {
 		b.log.With(ctx.fields...).Info("Ignoring update")
 		return nil
 	}
 
-	peerName := ""
-	var peer storage.Peer
-	switch p := msg.PeerID.(type) {
-	case *tg.PeerUser:
-		peer.PeerType = storage.User
-		peer.ID = p.UserID
-		ctx.peer = &tg.InputPeerUser{
-			UserID: p.UserID,
-		}
-
-		peerName = ctx.Users[p.UserID].Username
-	case *tg.PeerChat:
-		peer.PeerType = storage.Chat
-		peer.ID = p.ChatID
-		ctx.peer = &tg.InputPeerChat{
-			ChatID: p.ChatID,
-		}
+	// Access hashes are required to send notifications to users and channels.
+	if err := b.resolver.Save(ctx, ctx.Users, ctx.Channels); err != nil {
+		b.log.With(ctx.fields...).Warn("Failed to save access hashes", zap.Error(err))
+	}
 
-		peerName = ctx.Chats[p.ChatID].Title
-	default:
-		b.log.With(ctx.fields...).Info("Ignoring update")
+	peer, err := tgutil.ConvertPeer(msg.PeerID)
+	if err != nil {
+		b.log.With(ctx.fields...).Info("Ignoring update", zap.Error(err))
 		return nil
 	}
+	peer, err = b.resolver.Resolve(ctx, peer)
+	if err != nil {
+		return err
+	}
+	ctx.peer, err = tgutil.ConvertPeerToInputPeer(peer)
+	if err != nil {
+		return err
+	}
 
-	var username string
-	if peer.PeerType == storage.Chat {
-		from, ok := msg.FromID.(*tg.PeerUser)
-		if !ok {
-			b.log.With(ctx.fields...).Info(
-				"Ignoring update",
-				zap.String("from_id_type", fmt.Sprintf("%T", msg.FromID)),
-			)
-			return nil
-		}
-
-		username = ctx.Users[from.UserID].Username
-	} else {
-		username = peerName
+	peerName := tgutil.PeerName(ctx.Entities, peer)
+	username, ok := tgutil.SenderName(ctx.Entities, peer, msg)
+	if !ok {
+		b.log.With(ctx.fields...).Info(
+			"Ignoring update",
+			zap.String("from_id_type", fmt.Sprintf("%T", msg.FromID)),
+		)
+		return nil
 	}
 
 	ctx.fields = []zap.Field{
@@ -129,42 +132,206 @@ func (b *Bot) handleCommand(ctx updateContext, peer storage.Peer, args []string)
 			})
 		}
 
-		err = b.storage.Add(ctx, storage.Mapping{
+		return b.subscribe(ctx, peer, repo)
+	case "/addorg":
+		l.Info("Add owner command")
+		if len(args) < 1 {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "/addorg <url>\nПодписка на все репозитории организации или пользователя",
+			})
+		}
+
+		owner, err := storage.OwnerFromURL(args[0])
+		if err != nil {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "Некорректный URL.\nПример: https://github.com/gotd",
+			})
+		}
+
+		return b.subscribe(ctx, peer, owner)
+	case "/rmrepo", "/rmorg":
+		l.Info("Remove repository command")
+		if len(args) < 1 {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: command + " <url>",
+			})
+		}
+
+		repo, err := subscriptionFromURL(args[0])
+		if err != nil {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "Некорректный URL.\nПример: https://github.com/gotd/td",
+			})
+		}
+
+		err = b.storage.Remove(ctx, storage.Mapping{
 			Repo: repo,
 			Peer: peer,
 		})
+		if errors.Is(err, storage.ErrNotFound) {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: repo.ToGithubURL() + " не найден в подписках",
+			})
+		}
 		if err != nil {
 			return err
 		}
 
 		return ctx.Answer(&tg.MessagesSendMessageRequest{
-			Message: repo.ToGithubURL() + " добавлен",
+			Message: repo.ToGithubURL() + " удален",
 		})
-	case "/rmrepo":
-		l.Info("Remove repository command")
+	case "/filter":
+		l.Info("Filter command")
 		if len(args) < 1 {
 			return ctx.Answer(&tg.MessagesSendMessageRequest{
-				Message: "/rmrepo <url>",
+				Message: "/filter <url> [+kind] [-kind] [reset]\nТипы событий: " +
+					strings.Join(storage.AllKinds(), ", "),
 			})
 		}
 
-		repo, err := storage.RepoFromURL(args[0])
+		repo, err := subscriptionFromURL(args[0])
 		if err != nil {
 			return ctx.Answer(&tg.MessagesSendMessageRequest{
 				Message: "Некорректный URL.\nПример: https://github.com/gotd/td",
 			})
 		}
 
-		err = b.storage.Remove(ctx, storage.Mapping{
-			Repo: repo,
-			Peer: peer,
+		m, err := b.findMapping(ctx, peer, repo)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: repo.ToGithubURL() + " не найден в подписках",
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 1 {
+			if err := applyFilter(&m, args[1:]); err != nil {
+				var argErr *filterArgError
+				if !errors.As(err, &argErr) {
+					return err
+				}
+
+				message := fmt.Sprintf("Некорректный фильтр %q, ожидается +kind или -kind", argErr.Arg)
+				if errors.Is(err, errUnknownKind) {
+					message = fmt.Sprintf("Неизвестный тип событий %q", argErr.Arg[1:])
+				}
+				return ctx.Answer(&tg.MessagesSendMessageRequest{
+					Message: message,
+				})
+			}
+			if err := b.storage.Add(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		return ctx.Answer(&tg.MessagesSendMessageRequest{
+			Message: "События " + repo.ToGithubURL() + ": " + strings.Join(m.EnabledKinds(), ", "),
+		})
+	case "/branches":
+		l.Info("Branches command")
+		if len(args) < 1 {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "/branches <url> [pattern...] [reset]\nПример: /branches https://github.com/gotd/td main release/* !dependabot/**",
+			})
+		}
+
+		repo, err := subscriptionFromURL(args[0])
+		if err != nil {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "Некорректный URL.\nПример: https://github.com/gotd/td",
+			})
+		}
+
+		m, err := b.findMapping(ctx, peer, repo)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: repo.ToGithubURL() + " не найден в подписках",
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if patterns := args[1:]; len(patterns) > 0 {
+			if len(patterns) == 1 && patterns[0] == "reset" {
+				patterns = nil
+			}
+			for _, pattern := range patterns {
+				// Patterns are stored comma-separated.
+				if strings.Contains(pattern, ",") || strings.TrimPrefix(pattern, "!") == "" {
+					return ctx.Answer(&tg.MessagesSendMessageRequest{
+						Message: fmt.Sprintf("Некорректный шаблон %q", pattern),
+					})
+				}
+			}
+
+			m.Branches = patterns
+			if err := b.storage.Add(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		branches := "все"
+		if len(m.Branches) > 0 {
+			branches = strings.Join(m.Branches, " ")
+		}
+		return ctx.Answer(&tg.MessagesSendMessageRequest{
+			Message: "Ветки " + repo.ToGithubURL() + ": " + branches,
 		})
+	case "/where":
+		l.Info("Where command")
+		if len(args) < 1 {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "/where <url> [выражение|reset]\n" +
+					"Пример: /where https://github.com/gotd/td label:bug and not author:dependabot*\n" +
+					"Условия: label:<glob>, author:<glob>, path:<glob>, draft[:true|false]",
+			})
+		}
+
+		repo, err := subscriptionFromURL(args[0])
+		if err != nil {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: "Некорректный URL.\nПример: https://github.com/gotd/td",
+			})
+		}
+
+		m, err := b.findMapping(ctx, peer, repo)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ctx.Answer(&tg.MessagesSendMessageRequest{
+				Message: repo.ToGithubURL() + " не найден в подписках",
+			})
+		}
 		if err != nil {
 			return err
 		}
 
+		if len(args) > 1 {
+			expr := strings.Join(args[1:], " ")
+			if expr == "reset" {
+				expr = ""
+			}
+			if expr != "" {
+				if _, err := filter.Parse(expr); err != nil {
+					return ctx.Answer(&tg.MessagesSendMessageRequest{
+						Message: "Некорректный фильтр: " + err.Error(),
+					})
+				}
+			}
+
+			m.Filter = expr
+			if err := b.storage.Add(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		where := "нет"
+		if m.Filter != "" {
+			where = m.Filter
+		}
 		return ctx.Answer(&tg.MessagesSendMessageRequest{
-			Message: repo.ToGithubURL() + " удален",
+			Message: "Фильтр " + repo.ToGithubURL() + ": " + where,
 		})
 	case "/listrepo":
 		l.Info("List repository command")
@@ -182,7 +349,7 @@ func (b *Bot) handleCommand(ctx updateContext, peer storage.Peer, args []string)
 				result.WriteByte('\n')
 			}
 		} else {
-			result.WriteString("Не найдено ни одной подписки\nПример:\n /addrepo https://github.com/gotd/td")
+			result.WriteString("Не найдено ни одной подписки\nПример:\n /addrepo https://github.com/gotd/td\n /addorg https://github.com/gotd")
 		}
 
 		return ctx.Answer(&tg.MessagesSendMessageRequest{
@@ -193,3 +360,95 @@ func (b *Bot) handleCommand(ctx updateContext, peer storage.Peer, args []string)
 	}
 	return nil
 }
+
+// subscribe subscribes peer to the repository or owner, keeping settings of existing subscription.
+func (b *Bot) subscribe(ctx updateContext, peer storage.Peer, repo storage.Repo) error {
+	if !b.options.hostAllowed(repo) {
+		return ctx.Answer(&tg.MessagesSendMessageRequest{
+			Message: "Хост " + repo.Host + " не поддерживается",
+		})
+	}
+
+	m, err := b.findMapping(ctx, peer, repo)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		m = storage.Mapping{Repo: repo}
+	case err != nil:
+		return err
+	}
+	m.Peer = peer
+
+	if err := b.storage.Add(ctx, m); err != nil {
+		return err
+	}
+
+	return ctx.Answer(&tg.MessagesSendMessageRequest{
+		Message: repo.ToGithubURL() + " добавлен",
+	})
+}
+
+// subscriptionFromURL parses repository or owner URL.
+func subscriptionFromURL(rawurl string) (storage.Repo, error) {
+	repo, err := storage.RepoFromURL(rawurl)
+	if err == nil {
+		return repo, nil
+	}
+	return storage.OwnerFromURL(rawurl)
+}
+
+// findMapping returns peer subscription to the repository.
+// If peer is not subscribed, storage.ErrNotFound is returned.
+// Returned mapping peer is replaced by given one, so saving it updates access hash.
+func (b *Bot) findMapping(ctx context.Context, peer storage.Peer, repo storage.Repo) (storage.Mapping, error) {
+	mappings, err := b.storage.Get(ctx, peer)
+	if err != nil {
+		return storage.Mapping{}, err
+	}
+
+	for _, m := range mappings {
+		if m.Repo == repo {
+			m.Peer = peer
+			return m, nil
+		}
+	}
+	return storage.Mapping{}, storage.ErrNotFound
+}
+
+var (
+	errInvalidFilterArg = errors.New("expected +kind or -kind")
+	errUnknownKind      = errors.New("unknown event kind")
+)
+
+// filterArgError is an error of /filter command argument.
+type filterArgError struct {
+	Arg string
+	Err error
+}
+
+func (e *filterArgError) Error() string {
+	return fmt.Sprintf("invalid filter %q: %v", e.Arg, e.Err)
+}
+
+func (e *filterArgError) Unwrap() error {
+	return e.Err
+}
+
+// applyFilter applies /filter command arguments to the mapping.
+func applyFilter(m *storage.Mapping, args []string) error {
+	for _, arg := range args {
+		if arg == "reset" {
+			m.Kinds = nil
+			continue
+		}
+
+		if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+			return &filterArgError{Arg: arg, Err: errInvalidFilterArg}
+		}
+		kind := arg[1:]
+		if !storage.IsKind(kind) {
+			return &filterArgError{Arg: arg, Err: errUnknownKind}
+		}
+		m.SetKind(kind, arg[0] == '+')
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+const (
+	// workflowRunsPerPage is number of recently completed workflow runs fetched per poll.
+	workflowRunsPerPage = 30
+	// actionsAppSlug is a slug of Github Actions app.
+	actionsAppSlug = "github-actions"
+)
+
+// ciFailed whether workflow run or check suite conclusion should be reported.
+func ciFailed(conclusion string) bool {
+	switch conclusion {
+	case "failure", "timed_out", "action_required", "startup_failure":
+		return true
+	default:
+		return false
+	}
+}
+
+// onDefaultBranch whether branch is the default branch of repository.
+// If default branch is not known, any branch matches.
+func onDefaultBranch(repo *github.Repository, branch string) bool {
+	defaultBranch := repo.GetDefaultBranch()
+	return defaultBranch == "" || branch == defaultBranch
+}
+
+// defaultBranch returns default branch of repository. It is fetched once.
+func (s *Listener) defaultBranch(ctx context.Context, repo storage.Repo, state *repoState) (string, error) {
+	if state.defaultBranch != "" {
+		return state.defaultBranch, nil
+	}
+
+	gh, err := s.clients.Client(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	r, resp, err := gh.Repositories.Get(ctx, repo.Owner, repo.Name)
+	if resp != nil {
+		s.updateRate(gh, resp)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	state.defaultBranch = r.GetDefaultBranch()
+	return state.defaultBranch, nil
+}
+
+// fetchWorkflowRuns fetches recently completed workflow runs using conditional request.
+func (s *Listener) fetchWorkflowRuns(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+) (runs []WorkflowRun, modified bool, err error) {
+	gh, err := s.clients.Client(ctx, repo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	u := fmt.Sprintf("repos/%s/%s/actions/runs?status=completed&per_page=%d", repo.Owner, repo.Name, workflowRunsPerPage)
+	req, err := gh.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if state.runsETag != "" {
+		req.Header.Set("If-None-Match", state.runsETag)
+	}
+
+	// go-github does not decode workflow name, so response is decoded into own type.
+	var r struct {
+		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+	}
+	resp, err := gh.Do(ctx, req, &r)
+	if resp != nil {
+		s.updateRate(gh, resp)
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	state.runsETag = resp.Header.Get("ETag")
+	return r.WorkflowRuns, true, nil
+}
+
+// pollWorkflowRuns delivers workflow runs completed since cursor and returns next cursor.
+func (s *Listener) pollWorkflowRuns(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+	cursor storage.Cursor,
+	subscribers []storage.Mapping,
+) (storage.Cursor, error) {
+	runs, modified, err := s.fetchWorkflowRuns(ctx, repo, state)
+	if err != nil || !modified {
+		return cursor, err
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].UpdatedAt.Before(runs[j].UpdatedAt)
+	})
+
+	since := cursor.WorkflowRunsUpdatedAt
+	// If workflow runs are polled first time, skip all completed runs.
+	if !since.IsZero() {
+		// Only failures on the default branch are reported.
+		branch, err := s.defaultBranch(ctx, repo, state)
+		if err != nil {
+			return cursor, err
+		}
+
+		failed := false
+		for _, m := range subscribers {
+			if err := s.handleWorkflowRuns(ctx, m, since, branch, runs); err != nil {
+				failed = true
+				s.log.Error("Failed to handle workflow runs",
+					zap.String("repo", repo.ToGithubURL()),
+					zap.Int("peer_id", m.Peer.ID),
+					zap.Error(err),
+				)
+			}
+		}
+
+		if failed {
+			// Keep cursor and force refetch to retry undelivered runs,
+			// delivered ones are skipped as seen.
+			state.runsETag = ""
+			return cursor, nil
+		}
+	}
+
+	for _, run := range runs {
+		if run.UpdatedAt.After(since) {
+			since = run.UpdatedAt
+		}
+	}
+	if since.IsZero() {
+		// Repository has no completed runs yet.
+		since = time.Now()
+	}
+
+	cursor.WorkflowRunsUpdatedAt = since
+	return cursor, nil
+}
+
+// handleWorkflowRunsError delays next workflow runs poll after failure.
+//
+// Actions may be disabled or Github App may have no actions permission, while
+// events are still available, so such errors are retried with maximum interval.
+func (s *Listener) handleWorkflowRunsError(repo storage.Repo, state *repoState, err error) {
+	if state.runsBackoff == nil {
+		state.runsBackoff = newBackOff(s.pollTimeout)
+	}
+
+	delay := state.runsBackoff.NextBackOff()
+	if classifyError(err) == permanentError {
+		delay = state.runsBackoff.MaxInterval
+	}
+	state.runsNextPoll = time.Now().Add(delay)
+	s.log.Warn("Failed to poll workflow runs, retrying later",
+		zap.String("repo", repo.ToGithubURL()),
+		zap.Duration("delay", delay),
+		zap.Error(err),
+	)
+}
+
+func (s *Listener) handleWorkflowRuns(
+	ctx context.Context,
+	m storage.Mapping,
+	since time.Time,
+	defaultBranch string,
+	runs []WorkflowRun,
+) error {
+	for _, run := range runs {
+		if !run.UpdatedAt.After(since) {
+			continue
+		}
+
+		seen, err := s.seen.IsSeen(ctx, storage.SeenWorkflowRuns, m.Repo, m.Peer, run.ID)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+
+		e, ok := NewEvent(m, &WorkflowRunEvent{
+			Action:      "completed",
+			WorkflowRun: run,
+			Repo: &github.Repository{
+				DefaultBranch: &defaultBranch,
+			},
+		})
+		if !ok {
+			continue
+		}
+		match, err := s.matchFilter(ctx, e)
+		switch {
+		case isRetryableFilterError(err):
+			return err
+		case err != nil:
+			// Invalid expression must not block later runs.
+			s.log.Warn("Failed to match filter, skipping",
+				zap.String("repo", m.Repo.ToGithubURL()),
+				zap.Int("peer_id", m.Peer.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !match {
+			continue
+		}
+
+		// Stop on first transient failure to keep delivery order.
+		if err := s.deliver(ctx, storage.SeenWorkflowRuns, run.ID, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
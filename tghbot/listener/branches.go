@@ -0,0 +1,29 @@
+package listener
+
+import (
+	"strings"
+
+	"github.com/tdakkota/tghbot/tghbot/glob"
+)
+
+// matchBranch whether branch matches glob patterns.
+// Patterns prefixed with "!" exclude matching branches. Like Github Actions
+// branch filters, patterns are evaluated in order and the last matching pattern wins.
+// If there are no positive patterns, any branch matches by default.
+func matchBranch(patterns []string, branch string) bool {
+	matched := true
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "!") {
+			matched = false
+			break
+		}
+	}
+
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if glob.Match(strings.TrimPrefix(pattern, "!"), branch) {
+			matched = !negated
+		}
+	}
+	return matched
+}
@@ -0,0 +1,31 @@
+package listener
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchBranch(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		branch   string
+		match    bool
+	}{
+		{nil, "main", true},
+		{[]string{"main"}, "main", true},
+		{[]string{"main"}, "dev", false},
+		{[]string{"release/*"}, "release/v1", true},
+		{[]string{"release/*"}, "release/v1/hotfix", false},
+		{[]string{"release/**"}, "release/v1/hotfix", true},
+		{[]string{"v?"}, "v1", true},
+		{[]string{"!dependabot/**"}, "dependabot/go_modules/x", false},
+		{[]string{"!dependabot/**"}, "main", true},
+		{[]string{"**", "!dependabot/**"}, "feature", true},
+		{[]string{"**", "!dependabot/**"}, "dependabot/npm/y", false},
+		{[]string{"!dependabot/**", "dependabot/important"}, "dependabot/important", true},
+		{[]string{"fix.1"}, "fixx1", false},
+	} {
+		require.Equal(t, tt.match, matchBranch(tt.patterns, tt.branch), "%v %q", tt.patterns, tt.branch)
+	}
+}
@@ -0,0 +1,41 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v33/github"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// Clients provides Github API client for repository.
+type Clients interface {
+	Client(ctx context.Context, repo storage.Repo) (*github.Client, error)
+}
+
+// ClientsFunc is a functional adapter for Clients.
+type ClientsFunc func(ctx context.Context, repo storage.Repo) (*github.Client, error)
+
+func (f ClientsFunc) Client(ctx context.Context, repo storage.Repo) (*github.Client, error) {
+	return f(ctx, repo)
+}
+
+// StaticClient returns Clients which uses given client for all repositories.
+func StaticClient(gh *github.Client) Clients {
+	return ClientsFunc(func(ctx context.Context, repo storage.Repo) (*github.Client, error) {
+		return gh, nil
+	})
+}
+
+// HostClients returns Clients which selects clients by repository host.
+// Empty host key is used for github.com.
+func HostClients(hosts map[string]Clients) Clients {
+	return ClientsFunc(func(ctx context.Context, repo storage.Repo) (*github.Client, error) {
+		clients, ok := hosts[repo.Host]
+		if !ok {
+			return nil, fmt.Errorf("no Github client configured for host %q", repo.HostOrDefault())
+		}
+		return clients.Client(ctx, repo)
+	})
+}
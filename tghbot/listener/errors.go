@@ -0,0 +1,173 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/go-github/v33/github"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+type errorKind int
+
+const (
+	// transientError is an error which may disappear on retry, e.g. 5xx or network error.
+	transientError errorKind = iota
+	// rateLimitError means that rate limit is exceeded, polling should be paused until reset.
+	rateLimitError
+	// permanentError means that repository is not available anymore, e.g. deleted or made private.
+	permanentError
+)
+
+// maxDeliveryAttempts is maximum number of attempts to deliver event to a peer.
+// Event is skipped after that, so one peer does not hold the repository cursor.
+const maxDeliveryAttempts = 5
+
+// permanentDeliveryError is a handler error which will not disappear on retry.
+type permanentDeliveryError struct {
+	err error
+}
+
+func (e *permanentDeliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentDeliveryError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps handler error to mark that event can never be delivered to the peer,
+// e.g. bot is blocked or message is too long. Such events are skipped without retries.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentDeliveryError{err: err}
+}
+
+// IsPermanent whether handler error is marked as permanent.
+func IsPermanent(err error) bool {
+	var permanentErr *permanentDeliveryError
+	return errors.As(err, &permanentErr)
+}
+
+func classifyError(err error) errorKind {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateLimitError
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return transientError
+	}
+
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		switch respErr.Response.StatusCode {
+		case http.StatusNotFound, http.StatusGone, http.StatusForbidden, http.StatusUnavailableForLegalReasons:
+			return permanentError
+		}
+	}
+
+	return transientError
+}
+
+// errorReason returns human-readable reason of repository unavailability.
+func errorReason(err error) string {
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		code := respErr.Response.StatusCode
+		return fmt.Sprintf("%d %s", code, http.StatusText(code))
+	}
+	return err.Error()
+}
+
+func newBackOff(initial time.Duration) *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = initial
+	b.MaxInterval = 30 * time.Minute
+	// Retry forever.
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
+
+// handleRepoError isolates repository polling error, so it does not affect other repositories.
+func (s *Listener) handleRepoError(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+	subscribers []storage.Mapping,
+	err error,
+) {
+	l := s.log.With(zap.String("repo", repo.ToGithubURL()), zap.Error(err))
+
+	switch classifyError(err) {
+	case rateLimitError:
+		var rateErr *github.RateLimitError
+		if errors.As(err, &rateErr) {
+			// Clients are cached, so rate limit of the same client is updated.
+			if gh, err := s.clients.Client(ctx, repo); err == nil {
+				s.rates[gh] = rateErr.Rate
+			}
+		}
+		l.Warn("Github API rate limit exceeded")
+	case permanentError:
+		state.unavailable = true
+
+		// Subscribers are notified once, not after every restart.
+		cursor, cursorErr := s.cursors.GetCursor(ctx, repo)
+		if cursorErr != nil {
+			l.Error("Failed to get cursor", zap.NamedError("cursor_error", cursorErr))
+			return
+		}
+		if cursor.Unavailable {
+			l.Warn("Repository is still unavailable")
+			return
+		}
+		l.Error("Repository is unavailable, notifying subscribers")
+
+		for _, m := range subscribers {
+			e := Event{
+				Mapping: m,
+				Type:    "repo_unavailable",
+				Payload: Payload{
+					Data: RepoUnavailable{
+						Repo:   repo,
+						Reason: errorReason(err),
+					},
+				},
+			}
+			if err := s.handler(ctx, e); err != nil {
+				l.Error("Failed to notify subscriber",
+					zap.Int("peer_id", m.Peer.ID),
+					zap.NamedError("notify_error", err),
+				)
+			}
+		}
+
+		cursor.Unavailable = true
+		if err := s.cursors.SetCursor(ctx, repo, cursor); err != nil {
+			l.Error("Failed to set cursor", zap.NamedError("cursor_error", err))
+		}
+	default:
+		if state.backoff == nil {
+			state.backoff = newBackOff(s.pollTimeout)
+		}
+
+		delay := state.backoff.NextBackOff()
+		var abuseErr *github.AbuseRateLimitError
+		if errors.As(err, &abuseErr) && abuseErr.GetRetryAfter() > delay {
+			delay = abuseErr.GetRetryAfter()
+		}
+		state.nextPoll = time.Now().Add(delay)
+		l.Warn("Failed to poll repository, retrying later", zap.Duration("delay", delay))
+	}
+}
@@ -0,0 +1,140 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func responseError(code int) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: code},
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want errorKind
+	}{
+		{"NotFound", responseError(http.StatusNotFound), permanentError},
+		{"Gone", responseError(http.StatusGone), permanentError},
+		{"Forbidden", responseError(http.StatusForbidden), permanentError},
+		{"UnavailableForLegalReasons", responseError(http.StatusUnavailableForLegalReasons), permanentError},
+		{"InternalServerError", responseError(http.StatusInternalServerError), transientError},
+		{"BadGateway", responseError(http.StatusBadGateway), transientError},
+		{"RateLimit", &github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}, rateLimitError},
+		{"AbuseRateLimit", &github.AbuseRateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}, transientError},
+		{"Wrapped", fmt.Errorf("poll: %w", responseError(http.StatusNotFound)), permanentError},
+		{"Network", errors.New("connection reset"), transientError},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, classifyError(tt.err))
+		})
+	}
+}
+
+func TestNewBackOff(t *testing.T) {
+	a := require.New(t)
+	const initial = 10 * time.Second
+
+	b := newBackOff(initial)
+	prev := time.Duration(0)
+	for i := 0; i < 50; i++ {
+		delay := b.NextBackOff()
+		// Delay is randomized by ±50%.
+		a.Greater(delay, time.Duration(0))
+		a.LessOrEqual(delay, b.MaxInterval*3/2)
+		if i == 0 {
+			a.GreaterOrEqual(delay, initial/2)
+			a.LessOrEqual(delay, initial*3/2)
+		}
+		prev = delay
+	}
+	// Backoff never stops and reaches maximum interval.
+	a.GreaterOrEqual(prev, b.MaxInterval/2)
+}
+
+func TestListenerRepoErrors(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	requests := map[string]int{}
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/owner/deleted/events":
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		case "/repos/owner/broken/events":
+			http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+		case "/repos/owner/repo/events":
+			_, _ = fmt.Fprintf(w, `[
+				{"id":"2","type":"WatchEvent","created_at":%q,"payload":{"action":"started"}},
+				{"id":"1","type":"WatchEvent","created_at":%q,"payload":{"action":"started"}}
+			]`, now.Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	peer := storage.Peer{ID: 1}
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	deleted := storage.Repo{Owner: "owner", Name: "deleted"}
+	broken := storage.Repo{Owner: "owner", Name: "broken"}
+	store := storage.NewInMemoryStorage()
+	for _, r := range []storage.Repo{repo, deleted, broken} {
+		a.NoError(store.Add(ctx, storage.Mapping{Repo: r, Peer: peer, Kinds: []string{storage.KindStar}}))
+		a.NoError(store.SetCursor(ctx, r, storage.Cursor{EventID: 1, CreatedAt: now.Add(-time.Hour)}))
+	}
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		switch e.Type {
+		case "repo_unavailable":
+			data := e.Payload.Data.(RepoUnavailable)
+			delivered = append(delivered, e.Type+":"+data.Repo.Name+":"+data.Reason)
+		default:
+			delivered = append(delivered, e.Type+":"+e.Mapping.Repo.Name)
+		}
+		return nil
+	}
+	newListener := func() Listener {
+		return newTestListener(t, api, store, handler)
+	}
+
+	l := newListener()
+	a.NoError(l.poll(ctx))
+	// Broken repositories do not stop others.
+	a.ElementsMatch([]string{
+		"star:repo",
+		"repo_unavailable:deleted:404 Not Found",
+	}, delivered)
+	a.True(l.states[deleted].unavailable)
+	a.NotNil(l.states[broken].backoff)
+	a.True(l.states[broken].nextPoll.After(time.Now()))
+
+	// Unavailable repository is not polled again, broken one is retried after backoff.
+	a.NoError(l.poll(ctx))
+	a.Equal(1, requests["/repos/owner/deleted/events"])
+	a.Equal(1, requests["/repos/owner/broken/events"])
+
+	// Subscribers are not notified again after restart.
+	delivered = nil
+	l = newListener()
+	a.NoError(l.poll(ctx))
+	a.Equal(2, requests["/repos/owner/deleted/events"])
+	a.Empty(delivered)
+}
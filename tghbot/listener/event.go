@@ -2,6 +2,9 @@ package listener
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/go-github/v33/github"
 
 	"github.com/tdakkota/tghbot/tghbot/storage"
 )
@@ -29,4 +32,49 @@ type Event struct {
 	Payload Payload
 }
 
+// RepoUnavailable is a payload of "repo_unavailable" event, which is sent
+// when repository becomes permanently unavailable, e.g. deleted or made private.
+type RepoUnavailable struct {
+	Repo   storage.Repo
+	Reason string
+}
+
+// EventsGap is a payload of "events_gap" event, which is sent
+// when some repository events could not be fetched or are too old to deliver.
+type EventsGap struct {
+	Repo storage.Repo
+	// Since is creation time of last delivered event.
+	Since time.Time
+	// Until is creation time of oldest fetched event or maximum catch-up age limit.
+	Until time.Time
+}
+
+// WorkflowRun is a Github Actions workflow run.
+type WorkflowRun struct {
+	ID int64 `json:"id"`
+	// Name is a workflow name.
+	Name       string    `json:"name"`
+	RunNumber  int       `json:"run_number"`
+	HeadBranch string    `json:"head_branch"`
+	HeadSHA    string    `json:"head_sha"`
+	Event      string    `json:"event"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WorkflowRunEvent is a payload of "workflow_run" event.
+// It is used instead of github.WorkflowRunEvent, which does not contain workflow run.
+type WorkflowRunEvent struct {
+	Action      string             `json:"action"`
+	WorkflowRun WorkflowRun        `json:"workflow_run"`
+	Repo        *github.Repository `json:"repository"`
+}
+
+// GetRepo returns Repo field.
+func (e *WorkflowRunEvent) GetRepo() *github.Repository {
+	return e.Repo
+}
+
 type Handler func(ctx context.Context, e Event) error
@@ -0,0 +1,202 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/go-github/v33/github"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// repoState is a polling state of repository.
+type repoState struct {
+	// etag is ETag of last events response.
+	etag string
+	// runsETag is ETag of last workflow runs response.
+	runsETag string
+	// nextPoll is the earliest time of next poll.
+	nextPoll time.Time
+	// backoff is a retry policy of failing repository, nil if last poll succeeded.
+	backoff *backoff.ExponentialBackOff
+	// runsNextPoll is the earliest time of next workflow runs poll.
+	runsNextPoll time.Time
+	// runsBackoff is a retry policy of failing workflow runs polling, nil if last poll succeeded.
+	runsBackoff *backoff.ExponentialBackOff
+	// defaultBranch is a default branch of repository, empty if not fetched yet.
+	defaultBranch string
+	// unavailable whether repository is not available anymore.
+	unavailable bool
+}
+
+func (s *Listener) repoState(repo storage.Repo) *repoState {
+	state, ok := s.states[repo]
+	if !ok {
+		state = &repoState{}
+		s.states[repo] = state
+	}
+	return state
+}
+
+const (
+	// eventsPerPage is maximum page size of Github events API.
+	eventsPerPage = 100
+	// maxEvents is maximum number of events which Github events API returns.
+	maxEvents = 300
+)
+
+// fetchResult is a result of repository events fetch.
+type fetchResult struct {
+	// events are fetched events in reverse chronological order.
+	events []*github.Event
+	// modified whether events were modified since last request.
+	modified bool
+	// gap whether events between cursor and oldest fetched event could not be fetched.
+	gap bool
+}
+
+// fetchEvents fetches repository events since cursor using conditional request.
+// First page is requested with If-None-Match header, so if events were not modified
+// since last request, modified is false.
+func (s *Listener) fetchEvents(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+	cursor storage.Cursor,
+) (fetchResult, error) {
+	events, resp, err := s.fetchPage(ctx, repo, 1, state.etag)
+	if resp != nil {
+		state.nextPoll = time.Now().Add(pollInterval(resp, s.pollTimeout))
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return fetchResult{}, nil
+	}
+	if err != nil {
+		return fetchResult{}, err
+	}
+	etag := resp.Header.Get("ETag")
+
+	// Follow pagination until cursor is reached.
+	for !s.reached(events, cursor) && resp.NextPage != 0 && len(events) < maxEvents {
+		var page []*github.Event
+		page, resp, err = s.fetchPage(ctx, repo, resp.NextPage, "")
+		if err != nil {
+			return fetchResult{}, err
+		}
+		events = append(events, page...)
+	}
+
+	// Save ETag only if all pages are fetched, otherwise next poll
+	// may get Not Modified and skip rest of events.
+	state.etag = etag
+	return fetchResult{
+		events:   events,
+		modified: true,
+		gap:      !s.reached(events, cursor),
+	}, nil
+}
+
+// reached whether events contain all events since cursor.
+func (s *Listener) reached(events []*github.Event, cursor storage.Cursor) bool {
+	// Only newest events are needed to initialize cursor.
+	if cursor.IsZero() || len(events) == 0 {
+		return true
+	}
+
+	oldest := events[len(events)-1]
+	return eventID(oldest) <= cursor.EventID ||
+		oldest.GetCreatedAt().Before(cursor.CreatedAt) ||
+		oldest.GetCreatedAt().Before(s.minCreatedAt())
+}
+
+func (s *Listener) fetchPage(
+	ctx context.Context,
+	repo storage.Repo,
+	page int,
+	etag string,
+) ([]*github.Event, *github.Response, error) {
+	gh, err := s.clients.Client(ctx, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := fmt.Sprintf("repos/%s/%s/events?per_page=%d&page=%d", repo.Owner, repo.Name, eventsPerPage, page)
+	if repo.IsOwner() {
+		u = fmt.Sprintf("orgs/%s/events?per_page=%d&page=%d", repo.Owner, eventsPerPage, page)
+	}
+	req, err := gh.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	var events []*github.Event
+	resp, err := gh.Do(ctx, req, &events)
+	if resp != nil {
+		s.updateRate(gh, resp)
+	}
+	return events, resp, err
+}
+
+// pollInterval returns interval from X-Poll-Interval header
+// or given default if header is not set or it is less than default.
+func pollInterval(resp *github.Response, def time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("X-Poll-Interval"))
+	if err != nil {
+		return def
+	}
+
+	if d := time.Duration(seconds) * time.Second; d > def {
+		return d
+	}
+	return def
+}
+
+// updateRate updates rate limit of client.
+func (s *Listener) updateRate(gh *github.Client, resp *github.Response) {
+	// Header may be absent, e.g. for Github Enterprise without rate limiting.
+	if resp.Rate.Limit == 0 {
+		return
+	}
+
+	prev := s.rates[gh]
+	s.rates[gh] = resp.Rate
+
+	fields := []zap.Field{
+		zap.Int("limit", resp.Rate.Limit),
+		zap.Int("remaining", resp.Rate.Remaining),
+		zap.Time("reset", resp.Rate.Reset.Time),
+	}
+	// Crossing of reserve is logged once, not on every request.
+	known := prev.Limit != 0
+	switch {
+	case resp.Rate.Remaining <= s.rateReserve && (!known || prev.Remaining > s.rateReserve):
+		s.log.Info("Github API rate limit budget reached reserve", fields...)
+	case resp.Rate.Remaining > s.rateReserve && known && prev.Remaining <= s.rateReserve:
+		s.log.Info("Github API rate limit budget restored", fields...)
+	default:
+		s.log.Debug("Github API rate limit", fields...)
+	}
+}
+
+// rateLimited whether polling using client should be paused to save rate limit budget.
+func (s *Listener) rateLimited(gh *github.Client) bool {
+	rate := s.rates[gh]
+	if rate.Limit == 0 || rate.Remaining > s.rateReserve || time.Now().After(rate.Reset.Time) {
+		return false
+	}
+
+	s.log.Warn("Github API rate limit budget is low, pausing polling",
+		zap.Int("limit", rate.Limit),
+		zap.Int("remaining", rate.Remaining),
+		zap.Time("reset", rate.Reset.Time),
+	)
+	return true
+}
@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func TestPollInterval(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 10 * time.Second},
+		{"invalid", 10 * time.Second},
+		{"5", 10 * time.Second},
+		{"60", time.Minute},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("X-Poll-Interval", tt.header)
+		}
+		require.Equal(t, tt.want, pollInterval(&github.Response{Response: resp}, 10*time.Second), tt.header)
+	}
+}
+
+func TestListenerConditionalRequest(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	events := []fakeEvent{
+		newFakeEvent(101, "IssuesEvent", now.Add(-time.Minute), `{"action":"opened","issue":{"number":1}}`),
+		newFakeEvent(100, "IssuesEvent", now.Add(-time.Hour), `{"action":"opened","issue":{"number":0}}`),
+	}
+	var etags []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etags = append(etags, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		_ = json.NewEncoder(w).Encode(events)
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 100, CreatedAt: now.Add(-time.Hour)}))
+
+	delivered := 0
+	handler := func(ctx context.Context, e Event) error {
+		delivered++
+		return nil
+	}
+	l := newTestListener(t, api, store, handler)
+
+	a.NoError(l.poll(ctx))
+	a.Equal(1, delivered)
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(101), cursor.EventID)
+
+	// Cursor is moved back to check that Not Modified response does not change it.
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 100, CreatedAt: now.Add(-time.Hour)}))
+	l.states[repo].nextPoll = time.Time{}
+	a.NoError(l.poll(ctx))
+
+	a.Equal([]string{"", `"v1"`}, etags)
+	a.Equal(1, delivered)
+	cursor, err = store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(100), cursor.EventID)
+}
+
+func TestListenerPollIntervalHeader(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	requests := 0
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Poll-Interval", "120")
+		_, _ = w.Write([]byte("[]"))
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+
+	l := newTestListener(t, api, store, nil, WithPollTimeout(time.Second))
+	start := time.Now()
+	a.NoError(l.poll(ctx))
+	a.False(l.states[repo].nextPoll.Before(start.Add(120 * time.Second)))
+
+	// Repository is not polled before interval passes.
+	a.NoError(l.poll(ctx))
+	a.Equal(1, requests)
+}
+
+func TestListenerRateLimitReserve(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	reset := time.Now().Add(time.Hour).Unix()
+
+	requests := 0
+	remaining := 200
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		remaining -= 50
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		_, _ = w.Write([]byte("[]"))
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := newTestListener(t, api, store, nil,
+		WithRateLimitReserve(100),
+		WithLogger(zap.New(core)),
+	)
+	for i := 0; i < 4; i++ {
+		if state, ok := l.states[repo]; ok {
+			state.nextPoll = time.Time{}
+		}
+		a.NoError(l.poll(ctx))
+	}
+
+	// Polling is paused once remaining budget reaches reserve.
+	a.Equal(2, requests)
+	a.Equal(1, logs.FilterMessage("Github API rate limit budget reached reserve").Len())
+}
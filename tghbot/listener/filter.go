@@ -0,0 +1,225 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+
+	"github.com/tdakkota/tghbot/tghbot/filter"
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// maxFilesPages is maximum number of pull request files pages fetched for path filters.
+const maxFilesPages = 10
+
+// pathsError is an error of changed paths fetch.
+// Other filter errors are expression errors.
+type pathsError struct {
+	err error
+}
+
+func (e *pathsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pathsError) Unwrap() error {
+	return e.err
+}
+
+// isRetryableFilterError whether filter error may disappear on retry, e.g. server
+// error or exceeded rate limit. Expression errors and client errors of Github API,
+// e.g. compare of force-pushed commits, are not retried.
+func isRetryableFilterError(err error) bool {
+	var pathsErr *pathsError
+	if !errors.As(err, &pathsErr) {
+		return false
+	}
+
+	var respErr *github.ErrorResponse
+	return !errors.As(err, &respErr) || respErr.Response == nil ||
+		respErr.Response.StatusCode >= http.StatusInternalServerError
+}
+
+// pathsFetcher fetches changed paths of events.
+type pathsFetcher struct {
+	// clients may be nil, then paths are taken only from payload.
+	clients Clients
+	// onResponse is called with every Github API response, may be nil.
+	onResponse func(gh *github.Client, resp *github.Response)
+}
+
+func (f pathsFetcher) client(ctx context.Context, repo storage.Repo) (*github.Client, error) {
+	return f.clients.Client(ctx, repo)
+}
+
+func (f pathsFetcher) response(gh *github.Client, resp *github.Response) {
+	if resp != nil && f.onResponse != nil {
+		f.onResponse(gh, resp)
+	}
+}
+
+// MatchFilter whether event matches mapping filter expression.
+// Clients are used to fetch changed paths if filter has path conditions, may be nil.
+func MatchFilter(ctx context.Context, clients Clients, e Event) (bool, error) {
+	return matchFilter(ctx, pathsFetcher{clients: clients}, e)
+}
+
+// matchFilter whether event matches filter, tracking rate limit of path fetch requests.
+func (s *Listener) matchFilter(ctx context.Context, e Event) (bool, error) {
+	return matchFilter(ctx, pathsFetcher{clients: s.clients, onResponse: s.updateRate}, e)
+}
+
+func matchFilter(ctx context.Context, fetcher pathsFetcher, e Event) (bool, error) {
+	if e.Mapping.Filter == "" {
+		return true, nil
+	}
+
+	f, err := filter.Parse(e.Mapping.Filter)
+	if err != nil {
+		return false, err
+	}
+	return f.Match(subjectOf(ctx, fetcher, e.Mapping.Repo, e.Payload.Data))
+}
+
+func labelNames(labels []*github.Label) []string {
+	r := make([]string, 0, len(labels))
+	for _, label := range labels {
+		r = append(r, label.GetName())
+	}
+	return r
+}
+
+// subjectOf returns filter subject of event payload.
+func subjectOf(ctx context.Context, fetcher pathsFetcher, repo storage.Repo, p interface{}) filter.Subject {
+	switch payload := p.(type) {
+	case *github.PullRequestEvent:
+		return pullRequestSubject(ctx, fetcher, repo, payload.GetPullRequest(), payload.GetPullRequest().GetUser())
+	case *github.PullRequestReviewEvent:
+		return pullRequestSubject(ctx, fetcher, repo, payload.GetPullRequest(), payload.GetReview().GetUser())
+	case *github.PullRequestReviewCommentEvent:
+		return pullRequestSubject(ctx, fetcher, repo, payload.GetPullRequest(), payload.GetComment().GetUser())
+	case *github.IssuesEvent:
+		return filter.Subject{
+			Labels: labelNames(payload.GetIssue().Labels),
+			Author: payload.GetIssue().GetUser().GetLogin(),
+		}
+	case *github.IssueCommentEvent:
+		return filter.Subject{
+			Labels: labelNames(payload.GetIssue().Labels),
+			Author: payload.GetComment().GetUser().GetLogin(),
+		}
+	case *github.PushEvent:
+		author := payload.GetSender().GetLogin()
+		if author == "" {
+			author = payload.GetPusher().GetName()
+		}
+		return filter.Subject{
+			Author: author,
+			Paths: func() ([]string, error) {
+				return pushPaths(ctx, fetcher, repo, payload)
+			},
+		}
+	case interface{ GetSender() *github.User }:
+		return filter.Subject{
+			Author: payload.GetSender().GetLogin(),
+		}
+	default:
+		return filter.Subject{}
+	}
+}
+
+func pullRequestSubject(
+	ctx context.Context,
+	fetcher pathsFetcher,
+	repo storage.Repo,
+	pr *github.PullRequest,
+	author *github.User,
+) filter.Subject {
+	return filter.Subject{
+		Labels: labelNames(pr.Labels),
+		Author: author.GetLogin(),
+		Draft:  pr.GetDraft(),
+		Paths: func() ([]string, error) {
+			if fetcher.clients == nil {
+				return nil, nil
+			}
+			gh, err := fetcher.client(ctx, repo)
+			if err != nil {
+				return nil, &pathsError{err: err}
+			}
+
+			var paths []string
+			opts := &github.ListOptions{PerPage: 100}
+			for page := 0; page < maxFilesPages; page++ {
+				files, resp, err := gh.PullRequests.ListFiles(ctx, repo.Owner, repo.Name, pr.GetNumber(), opts)
+				fetcher.response(gh, resp)
+				if err != nil {
+					return nil, &pathsError{err: err}
+				}
+				for _, file := range files {
+					paths = append(paths, file.GetFilename())
+				}
+
+				if resp.NextPage == 0 {
+					break
+				}
+				opts.Page = resp.NextPage
+			}
+			return paths, nil
+		},
+	}
+}
+
+// isZeroSHA whether commit SHA is empty or all-zero.
+func isZeroSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// pushPaths returns paths changed by push.
+// Webhook payload contains changed files of commits, events API payload does not,
+// so they are fetched using compare API.
+func pushPaths(ctx context.Context, fetcher pathsFetcher, repo storage.Repo, payload *github.PushEvent) ([]string, error) {
+	var (
+		paths []string
+		found bool
+	)
+	for _, commit := range payload.Commits {
+		if commit.Added == nil && commit.Removed == nil && commit.Modified == nil {
+			continue
+		}
+		found = true
+		paths = append(paths, commit.Added...)
+		paths = append(paths, commit.Removed...)
+		paths = append(paths, commit.Modified...)
+	}
+	if found || fetcher.clients == nil {
+		return paths, nil
+	}
+
+	head := payload.GetHead()
+	if head == "" {
+		head = payload.GetAfter()
+	}
+	// Before SHA of new branch and after SHA of deleted one are zero,
+	// there is nothing to compare.
+	if isZeroSHA(payload.GetBefore()) || isZeroSHA(head) {
+		return nil, nil
+	}
+
+	gh, err := fetcher.client(ctx, repo)
+	if err != nil {
+		return nil, &pathsError{err: err}
+	}
+	cmp, resp, err := gh.Repositories.CompareCommits(ctx, repo.Owner, repo.Name, payload.GetBefore(), head)
+	fetcher.response(gh, resp)
+	if err != nil {
+		return nil, &pathsError{err: err}
+	}
+	for _, file := range cmp.Files {
+		paths = append(paths, file.GetFilename())
+	}
+	return paths, nil
+}
@@ -0,0 +1,148 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func TestMatchFilter(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+
+	clients := StaticClient(newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/owner/repo/compare/aaa...bbb":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"files": []map[string]string{{"filename": "docs/index.md"}},
+			})
+		case "/repos/owner/repo/pulls/1/files":
+			_ = json.NewEncoder(w).Encode([]map[string]string{{"filename": "main.go"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+
+	decode := func(typ, payload string) interface{} {
+		raw := json.RawMessage(payload)
+		p, err := (&github.Event{Type: &typ, RawPayload: &raw}).ParsePayload()
+		require.NoError(t, err)
+		return p
+	}
+	pr := `{"action":"opened","pull_request":{"number":1,"draft":true,"user":{"login":"dependabot[bot]"},"labels":[{"name":"Bug"}]}}`
+	eventsPush := `{"ref":"refs/heads/main","before":"aaa","head":"bbb"}`
+	newBranchPush := `{"ref":"refs/heads/new","before":"0000000000000000000000000000000000000000","head":"bbb"}`
+	webhookPush := `{"ref":"refs/heads/main","commits":[{"added":["README.md"],"removed":[],"modified":[]}]}`
+
+	for _, tt := range []struct {
+		name    string
+		filter  string
+		typ     string
+		payload string
+		match   bool
+	}{
+		{"Empty", "", "PullRequestEvent", pr, true},
+		{"Label", "label:bug", "PullRequestEvent", pr, true},
+		{"Author", "not author:dependabot*", "PullRequestEvent", pr, false},
+		{"Draft", "draft:false", "PullRequestEvent", pr, false},
+		{"PullRequestPath", "path:*.go", "PullRequestEvent", pr, true},
+		{"EventsPushPath", "path:docs/**", "PushEvent", eventsPush, true},
+		{"NewBranchPushPath", "path:docs/**", "PushEvent", newBranchPush, false},
+		{"WebhookPushPath", "path:docs/**", "PushEvent", webhookPush, false},
+		{"NoLabels", "label:bug", "PushEvent", webhookPush, false},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			e := Event{
+				Mapping: storage.Mapping{Repo: repo, Filter: tt.filter},
+				Payload: Payload{Data: decode(tt.typ, tt.payload)},
+			}
+
+			match, err := MatchFilter(ctx, clients, e)
+			a.NoError(err)
+			a.Equal(tt.match, match)
+		})
+	}
+}
+
+func TestListenerFilterErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	now := time.Now().UTC().Truncate(time.Second)
+	reset := now.Add(time.Hour).Unix()
+
+	for _, tt := range []struct {
+		name          string
+		filter        string
+		compareStatus int
+		delivered     int
+		cursor        int64
+	}{
+		// Transient error is retried on next poll, event is not lost.
+		{"ServerError", "path:docs/**", http.StatusInternalServerError, 0, 100},
+		// Compare of force-pushed commits fails permanently.
+		{"NotFound", "path:docs/**", http.StatusNotFound, 0, 101},
+		{"InvalidExpression", "path:", http.StatusOK, 0, 101},
+		{"Match", "path:docs/**", http.StatusOK, 1, 101},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			events := []fakeEvent{
+				newFakeEvent(101, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/main","before":"aaa","head":"bbb"}`),
+				newFakeEvent(100, "IssuesEvent", now.Add(-time.Hour), `{"action":"opened","issue":{"number":0}}`),
+			}
+			api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/repos/owner/repo/events":
+					_ = json.NewEncoder(w).Encode(events)
+				case "/repos/owner/repo/compare/aaa...bbb":
+					w.Header().Set("X-RateLimit-Limit", "5000")
+					w.Header().Set("X-RateLimit-Remaining", "4000")
+					w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+					w.WriteHeader(tt.compareStatus)
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{
+						"files": []map[string]string{{"filename": "docs/index.md"}},
+					})
+				default:
+					http.NotFound(w, r)
+				}
+			})
+
+			store := storage.NewInMemoryStorage()
+			a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}, Filter: tt.filter}))
+			a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 100, CreatedAt: now.Add(-time.Hour)}))
+
+			delivered := 0
+			handler := func(ctx context.Context, e Event) error {
+				delivered++
+				return nil
+			}
+			l := newTestListener(t, api, store, handler)
+			a.NoError(l.poll(ctx))
+
+			a.Equal(tt.delivered, delivered)
+			cursor, err := store.GetCursor(ctx, repo)
+			a.NoError(err)
+			a.Equal(tt.cursor, cursor.EventID)
+			if tt.filter != "path:" {
+				// Rate limit budget tracks compare requests.
+				a.Len(l.rates, 1)
+				for _, rate := range l.rates {
+					a.Equal(4000, rate.Remaining)
+				}
+			}
+		})
+	}
+}
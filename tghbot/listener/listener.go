@@ -2,6 +2,10 @@ package listener
 
 import (
 	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,13 +16,35 @@ import (
 )
 
 type Listener struct {
-	gh      *github.Client
+	clients Clients
 	storage storage.Storage
+	cursors storage.CursorStorage
+	seen    storage.SeenStorage
 
 	handler     Handler
 	pollTimeout time.Duration
-	lastUpdate  time.Time
-	log         *zap.Logger
+	maxCatchUp  time.Duration
+	rateReserve int
+	// workflowRuns whether workflow runs are polled.
+	workflowRuns bool
+	log          *zap.Logger
+
+	states map[storage.Repo]*repoState
+	owners map[storage.Repo]*ownerState
+	// rates are rate limits of clients. Every Github App installation
+	// and Github Enterprise Server host has its own budget.
+	rates map[*github.Client]github.Rate
+	// attempts are numbers of failed delivery attempts of undelivered events.
+	attempts map[deliveryKey]int
+}
+
+// deliveryKey identifies delivery of event to the peer.
+type deliveryKey struct {
+	Kind     storage.SeenKind
+	Repo     storage.Repo
+	PeerType storage.PeerType
+	PeerID   int
+	EventID  int64
 }
 
 func WithPollTimeout(pollTimeout time.Duration) func(*Listener) {
@@ -27,25 +53,88 @@ func WithPollTimeout(pollTimeout time.Duration) func(*Listener) {
 	}
 }
 
+// WithCursorStorage sets storage of repository event cursors.
+// By default, cursors are stored in memory and lost on restart.
+func WithCursorStorage(cursors storage.CursorStorage) func(*Listener) {
+	return func(listener *Listener) {
+		listener.cursors = cursors
+	}
+}
+
+// WithSeenStorage sets storage of delivered events.
+// By default, delivered events are stored in memory and lost on restart.
+func WithSeenStorage(seen storage.SeenStorage) func(*Listener) {
+	return func(listener *Listener) {
+		listener.seen = seen
+	}
+}
+
+// WithMaxCatchUp sets maximum age of events delivered after restart.
+// Zero means no limit.
+func WithMaxCatchUp(maxCatchUp time.Duration) func(*Listener) {
+	return func(listener *Listener) {
+		listener.maxCatchUp = maxCatchUp
+	}
+}
+
+// WithRateLimitReserve sets number of Github API requests which are kept in reserve.
+// Polling is paused until rate limit reset, if remaining requests budget is less than reserve.
+func WithRateLimitReserve(reserve int) func(*Listener) {
+	return func(listener *Listener) {
+		listener.rateReserve = reserve
+	}
+}
+
+// WithWorkflowRuns enables polling of completed Github Actions workflow runs.
+// It costs one more API request per repository poll.
+//
+// Public repositories of subscribed organizations are not polled separately,
+// so their workflow runs are not reported. Use webhook mode or subscribe to
+// such repositories directly.
+func WithWorkflowRuns(enabled bool) func(*Listener) {
+	return func(listener *Listener) {
+		listener.workflowRuns = enabled
+	}
+}
+
 func WithLogger(logger *zap.Logger) func(*Listener) {
 	return func(listener *Listener) {
 		listener.log = logger
 	}
 }
 
-func NewListener(gh *github.Client, storage storage.Storage, handler Handler, opts ...func(*Listener)) Listener {
+func NewListener(clients Clients, store storage.Storage, handler Handler, opts ...func(*Listener)) Listener {
 	s := Listener{
-		gh:          gh,
-		storage:     storage,
+		clients:     clients,
+		storage:     store,
 		handler:     handler,
 		pollTimeout: 10 * time.Second,
-		lastUpdate:  time.Now(),
+		maxCatchUp:  24 * time.Hour,
+		rateReserve: 100,
+		states:      map[storage.Repo]*repoState{},
+		owners:      map[storage.Repo]*ownerState{},
+		rates:       map[*github.Client]github.Rate{},
+		attempts:    map[deliveryKey]int{},
 	}
 
 	for _, op := range opts {
 		op(&s)
 	}
 
+	if s.pollTimeout <= 0 {
+		s.pollTimeout = 10 * time.Second
+	}
+
+	if s.cursors == nil || s.seen == nil {
+		mem := storage.NewInMemoryStorage()
+		if s.cursors == nil {
+			s.cursors = mem
+		}
+		if s.seen == nil {
+			s.seen = mem
+		}
+	}
+
 	if s.log == nil {
 		s.log, _ = zap.NewDevelopment(zap.IncreaseLevel(zapcore.DebugLevel))
 	}
@@ -53,7 +142,7 @@ func NewListener(gh *github.Client, storage storage.Storage, handler Handler, op
 	return s
 }
 
-func (s Listener) Run(ctx context.Context) error {
+func (s *Listener) Run(ctx context.Context) error {
 	timer := time.NewTimer(s.pollTimeout)
 
 	s.log.Info("running Github API event listener")
@@ -66,105 +155,679 @@ func (s Listener) Run(ctx context.Context) error {
 		case <-timer.C:
 			timer.Reset(s.pollTimeout)
 
-			mappings, err := s.storage.List(ctx)
-			if err != nil {
-				return err
+			if err := s.poll(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				s.log.Error("Failed to poll events", zap.Error(err))
 			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
 
-			for _, m := range mappings {
-				repo := m.Repo
-				events, resp, err := s.gh.Activity.ListRepositoryEvents(ctx, repo.Owner, repo.Name, nil)
-				if err != nil {
-					return err
-				}
+// poll fetches events of every subscribed repository once and
+// fans them out to all repository subscribers.
+func (s *Listener) poll(ctx context.Context) error {
+	mappings, err := s.storage.List(ctx)
+	if err != nil {
+		return err
+	}
 
-				if resp.Header.Get("X-From-Cache") == "1" {
-					s.log.Info("skipping due to events got from cache")
-					continue
-				}
+	s.pruneAttempts(mappings)
 
-				err = s.handleEvents(ctx, m, events)
-				if err != nil {
-					return err
-				}
+	repos := map[storage.Repo][]storage.Mapping{}
+	for _, m := range mappings {
+		repos[m.Repo] = append(repos[m.Repo], m)
+	}
+	orgs := s.expandSubscriptions(ctx, repos)
+
+	// Forget state of repositories without subscribers,
+	// so unavailable repository is polled again after resubscription.
+	for repo := range s.states {
+		if _, ok := repos[repo]; !ok {
+			delete(s.states, repo)
+		}
+	}
+
+	for repo, subscribers := range repos {
+		// User events are polled per repository.
+		if repo.IsOwner() && !orgs[repo] {
+			continue
+		}
+
+		state := s.repoState(repo)
+		if state.unavailable || time.Now().Before(state.nextPoll) {
+			continue
+		}
+
+		gh, err := s.clients.Client(ctx, repo)
+		if err == nil {
+			// Exhausted client does not pause polling of repositories using other clients.
+			if s.rateLimited(gh) {
+				continue
 			}
-		case <-ctx.Done():
-			return nil
+			err = s.pollRepo(ctx, repo, state, subscribers)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.handleRepoError(ctx, repo, state, subscribers, err)
+			continue
 		}
+		state.backoff = nil
 	}
+
+	return nil
 }
 
-func (s *Listener) handleEvents(ctx context.Context, m storage.Mapping, events []*github.Event) error {
-	c := 0
+// pruneAttempts forgets delivery attempts of removed mappings.
+func (s *Listener) pruneAttempts(mappings []storage.Mapping) {
+	type subscription struct {
+		Repo     storage.Repo
+		PeerType storage.PeerType
+		PeerID   int
+	}
+
+	subscriptions := map[subscription]struct{}{}
+	for _, m := range mappings {
+		subscriptions[subscription{m.Repo, m.Peer.PeerType, m.Peer.ID}] = struct{}{}
+	}
+
+	for key := range s.attempts {
+		// Events of owner subscriptions are delivered as events of particular repository.
+		owner := storage.Repo{Host: key.Repo.Host, Owner: key.Repo.Owner}
+		_, ok := subscriptions[subscription{key.Repo, key.PeerType, key.PeerID}]
+		_, ownerOK := subscriptions[subscription{owner, key.PeerType, key.PeerID}]
+		if !ok && !ownerOK {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+func (s *Listener) pollRepo(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+	subscribers []storage.Mapping,
+) error {
+	cursor, err := s.cursors.GetCursor(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	next, err := s.pollEvents(ctx, repo, state, cursor, subscribers)
+	if err != nil {
+		return err
+	}
+	if s.workflowRuns && !repo.IsOwner() && !time.Now().Before(state.runsNextPoll) {
+		// Workflow runs failure must not affect events cursor and repository availability.
+		runsCursor, err := s.pollWorkflowRuns(ctx, repo, state, next, subscribers)
+		switch {
+		case err == nil:
+			next = runsCursor
+			state.runsBackoff = nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			s.handleWorkflowRunsError(repo, state, err)
+		}
+	}
+	// Repository is available again.
+	next.Unavailable = false
+
+	if next == cursor {
+		return nil
+	}
+	return s.cursors.SetCursor(ctx, repo, next)
+}
+
+// pollEvents delivers new repository events and returns next cursor.
+func (s *Listener) pollEvents(
+	ctx context.Context,
+	repo storage.Repo,
+	state *repoState,
+	cursor storage.Cursor,
+	subscribers []storage.Mapping,
+) (storage.Cursor, error) {
+	r, err := s.fetchEvents(ctx, repo, state, cursor)
+	if err != nil {
+		return cursor, err
+	}
+	if !r.modified {
+		s.log.Debug("Events not modified", zap.String("repo", repo.ToGithubURL()))
+		return cursor, nil
+	}
+	events := r.events
 
+	if r.gap {
+		// Cursor may be kept to retry failed deliveries, so the same gap
+		// is fetched again. Cursor time is advanced to report it once.
+		if until := events[len(events)-1].GetCreatedAt(); cursor.CreatedAt.Before(until) {
+			s.reportGap(ctx, repo, EventsGap{Repo: repo, Since: cursor.CreatedAt, Until: until}, subscribers)
+			cursor.CreatedAt = until
+		}
+	}
+	// Events older than maximum catch-up age are skipped, e.g. after long downtime.
+	if until := s.minCreatedAt(); !cursor.IsZero() && s.skipsEvents(cursor, events, until) {
+		s.reportGap(ctx, repo, EventsGap{Repo: repo, Since: cursor.CreatedAt, Until: until}, subscribers)
+		cursor.CreatedAt = until
+	}
+
+	// If repository is polled first time, skip all existing events.
+	if !cursor.IsZero() {
+		failed := false
+		for _, m := range subscribers {
+			// Delivery error must not affect other subscribers.
+			// Failed events are not marked as seen, so they will be retried on next poll,
+			// unless delivery failed permanently or too many times.
+			if err := s.handleEvents(ctx, m, cursor, events); err != nil {
+				failed = true
+				s.log.Error("Failed to handle events",
+					zap.String("repo", repo.ToGithubURL()),
+					zap.Int("peer_id", m.Peer.ID),
+					zap.Error(err),
+				)
+			}
+		}
+
+		if failed {
+			// Keep cursor and force refetch to retry undelivered events,
+			// delivered ones are skipped as seen.
+			state.etag = ""
+			return cursor, nil
+		}
+	}
+
+	return newestCursor(cursor, events), nil
+}
+
+func eventID(event *github.Event) int64 {
+	id, err := strconv.ParseInt(event.GetID(), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// newestCursor returns cursor pointing to the newest of given events.
+func newestCursor(cursor storage.Cursor, events []*github.Event) storage.Cursor {
 	for _, event := range events {
+		if id := eventID(event); id > cursor.EventID {
+			cursor.EventID = id
+			cursor.CreatedAt = event.GetCreatedAt()
+		}
+	}
+	if cursor.IsZero() {
+		// Repository has no events yet.
+		cursor.CreatedAt = time.Now()
+	}
+	return cursor
+}
+
+// minCreatedAt returns creation time of oldest event which may be delivered.
+func (s *Listener) minCreatedAt() time.Time {
+	if s.maxCatchUp <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-s.maxCatchUp)
+}
+
+// skipsEvents whether some events since cursor are older than minCreatedAt,
+// so they are not delivered.
+func (s *Listener) skipsEvents(cursor storage.Cursor, events []*github.Event, minCreatedAt time.Time) bool {
+	for _, event := range events {
+		createdAt := event.GetCreatedAt()
+		if eventID(event) > cursor.EventID && createdAt.After(cursor.CreatedAt) && createdAt.Before(minCreatedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportGap notifies subscribers that some events were lost, because
+// Github events API does not return events older than last 300
+// or events are older than maximum catch-up age.
+func (s *Listener) reportGap(
+	ctx context.Context,
+	repo storage.Repo,
+	gap EventsGap,
+	subscribers []storage.Mapping,
+) {
+	l := s.log.With(
+		zap.String("repo", repo.ToGithubURL()),
+		zap.Time("since", gap.Since),
+		zap.Time("until", gap.Until),
+	)
+	l.Warn("Some events could not be fetched")
+
+	for _, m := range subscribers {
+		if err := s.handler(ctx, Event{
+			Mapping: m,
+			Type:    "events_gap",
+			Payload: Payload{Data: gap},
+		}); err != nil {
+			l.Error("Failed to notify subscriber",
+				zap.Int("peer_id", m.Peer.ID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// sortEvents sorts events in chronological order.
+// Github returns events in reverse chronological order.
+func sortEvents(events []*github.Event) []*github.Event {
+	sorted := append([]*github.Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.GetCreatedAt().Equal(b.GetCreatedAt()) {
+			return a.GetCreatedAt().Before(b.GetCreatedAt())
+		}
+		return eventID(a) < eventID(b)
+	})
+	return sorted
+}
+
+func (s *Listener) handleEvents(ctx context.Context, m storage.Mapping, cursor storage.Cursor, events []*github.Event) error {
+	c := 0
+	minCreatedAt := s.minCreatedAt()
+
+	owner := m
+	for _, event := range sortEvents(events) {
+		id := eventID(event)
+		if id <= cursor.EventID || event.GetCreatedAt().Before(minCreatedAt) {
+			continue
+		}
+
+		// Organization events are delivered as events of particular repository.
+		if owner.Repo.IsOwner() {
+			repo, ok := eventRepo(owner.Repo, event)
+			if !ok {
+				continue
+			}
+			m = owner
+			m.Repo = repo
+		}
 		l := s.log.With(
 			zap.String("repo", m.Repo.ToGithubURL()),
 			zap.String("event_type", event.GetType()),
 		)
-		if event.GetCreatedAt().Before(s.lastUpdate) {
+
+		seen, err := s.seen.IsSeen(ctx, storage.SeenEvents, m.Repo, m.Peer, id)
+		if err != nil {
+			return err
+		}
+		if seen {
 			continue
 		}
-		s.lastUpdate = time.Now().Add(s.pollTimeout * -1).Add(time.Second)
 		c++
 
 		l.Info("handling event")
 		p, err := event.ParsePayload()
 		if err != nil {
+			l.Warn("Failed to parse event payload, skipping", zap.Error(err))
+			continue
+		}
+
+		setSender(p, event.Actor)
+		setPrereleaseAction(p)
+
+		e, ok := NewEvent(m, p)
+		if !ok {
+			continue
+		}
+		match, err := s.matchFilter(ctx, e)
+		switch {
+		case isRetryableFilterError(err):
+			// Event will be retried on next poll.
 			return err
+		case err != nil:
+			// Invalid expression or paths which can not be fetched must not block later events.
+			l.Warn("Failed to match filter, skipping", zap.Error(err))
+			continue
+		}
+		if !match {
+			continue
 		}
 
-		e := Event{
-			Mapping: m,
-			Payload: Payload{
-				Data: p,
-			},
-		}
-		repoName := m.Repo.Name
-		switch payload := p.(type) {
-		case *github.PullRequestEvent:
-			payload.Repo = &github.Repository{
-				Name: &repoName,
-			}
+		// Stop on first transient failure to keep delivery order, rest of events will be retried on next poll.
+		if err := s.deliver(ctx, storage.SeenEvents, id, e); err != nil {
+			return err
+		}
+	}
 
-			if payload.GetAction() == "opened" && payload.PullRequest != nil {
-				e.Type = "pr"
-				e.Payload.AddLink("diff", payload.PullRequest.GetDiffURL())
-				return s.handler(ctx, e)
-			}
-		case *github.ReleaseEvent:
-			payload.Repo = &github.Repository{
-				Name: &repoName,
-			}
+	if c == 0 {
+		s.log.Info("No new events")
+	}
 
-			if payload.GetAction() == "published" && payload.Release != nil {
-				e.Type = "release"
-				e.Payload.AddLink("Релиз", payload.Release.GetURL())
-				return s.handler(ctx, e)
-			}
-		case *github.PushEvent:
-			payload.Repo = &github.PushEventRepository{
-				Name: &repoName,
-			}
+	return nil
+}
 
-			e.Type = "push"
-			return s.handler(ctx, e)
-		case *github.IssuesEvent:
-			payload.Repo = &github.Repository{
-				Name: &repoName,
-			}
+// Template names of pull request, issue and release actions.
+// Closed and merged pull request are distinguished by "merged" pseudo-action.
+var (
+	pullRequestTemplates = map[string]string{
+		"opened":           "pr",
+		"closed":           "pr_closed",
+		"merged":           "pr_merged",
+		"reopened":         "pr_reopened",
+		"ready_for_review": "pr_ready_for_review",
+		"labeled":          "pr_labeled",
+		"assigned":         "pr_assigned",
+	}
+	issueTemplates = map[string]string{
+		"opened":   "issue",
+		"closed":   "issue_closed",
+		"reopened": "issue_reopened",
+		"labeled":  "issue_labeled",
+		"assigned": "issue_assigned",
+	}
+	releaseTemplates = map[string]string{
+		"published":   "release",
+		"prereleased": "release_prereleased",
+	}
+)
+
+// setSender sets sender of event payloads to the event actor.
+// Unlike webhooks, events API payloads do not contain sender.
+func setSender(p interface{}, actor *github.User) {
+	switch payload := p.(type) {
+	case *github.PushEvent:
+		payload.Sender = actor
+	case *github.CreateEvent:
+		payload.Sender = actor
+	case *github.DeleteEvent:
+		payload.Sender = actor
+	case *github.ForkEvent:
+		payload.Sender = actor
+	case *github.WatchEvent:
+		payload.Sender = actor
+	case *github.MemberEvent:
+		payload.Sender = actor
+	case *github.PublicEvent:
+		payload.Sender = actor
+	case *github.GollumEvent:
+		payload.Sender = actor
+	}
+}
+
+// setPrereleaseAction sets "prereleased" action of published pre-release.
+// Unlike webhooks, events API emits only "published" action for both releases and pre-releases.
+func setPrereleaseAction(p interface{}) {
+	payload, ok := p.(*github.ReleaseEvent)
+	if !ok || payload.GetAction() != "published" || !payload.GetRelease().GetPrerelease() {
+		return
+	}
 
-			if payload.GetAction() == "opened" && payload.Issue != nil {
-				e.Type = "issue"
-				e.Payload.AddLink("Issue", payload.Issue.GetURL())
-				return s.handler(ctx, e)
+	action := "prereleased"
+	payload.Action = &action
+}
+
+// eventKinds maps event types to event kinds.
+var eventKinds = map[string]string{
+	"pr":                  storage.KindPR,
+	"pr_closed":           storage.KindPR,
+	"pr_merged":           storage.KindPR,
+	"pr_reopened":         storage.KindPR,
+	"pr_ready_for_review": storage.KindPR,
+	"pr_labeled":          storage.KindPR,
+	"pr_assigned":         storage.KindPR,
+	"issue":               storage.KindIssue,
+	"issue_closed":        storage.KindIssue,
+	"issue_reopened":      storage.KindIssue,
+	"issue_labeled":       storage.KindIssue,
+	"issue_assigned":      storage.KindIssue,
+	"release":             storage.KindRelease,
+	"release_prereleased": storage.KindRelease,
+	"push":                storage.KindPush,
+	"issue_comment":       storage.KindComment,
+	"pr_review_comment":   storage.KindComment,
+	"pr_review":           storage.KindReview,
+	"workflow_run":        storage.KindCI,
+	"check_suite":         storage.KindCI,
+	"create":              storage.KindCreate,
+	"delete":              storage.KindDelete,
+	"fork":                storage.KindFork,
+	"star":                storage.KindStar,
+	"member":              storage.KindMember,
+	"public":              storage.KindPublic,
+	"wiki":                storage.KindWiki,
+}
+
+// NewEvent creates Event from Github event payload.
+// It is used by both events API poller and webhook receiver.
+// If event should not be delivered, e.g. its kind is not enabled for mapping, ok is false.
+func NewEvent(m storage.Mapping, p interface{}) (e Event, ok bool) {
+	e, ok = newEvent(m, p)
+	if !ok || !m.Enabled(eventKinds[e.Type]) {
+		return Event{}, false
+	}
+	return e, true
+}
+
+// repository returns repository of event payload. Events API payloads have no
+// repository, so it is set in both modes to render templates the same way.
+func repository(repo storage.Repo) *github.Repository {
+	return &github.Repository{
+		Name:    github.String(repo.Name),
+		HTMLURL: github.String(repo.ToGithubURL()),
+	}
+}
+
+// copyPayload returns shallow copy of payload, so payload shared between
+// mappings is not changed by newEvent.
+func copyPayload(p interface{}) interface{} {
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return p
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface()
+}
+
+func newEvent(m storage.Mapping, p interface{}) (e Event, ok bool) {
+	p = copyPayload(p)
+	e = Event{
+		Mapping: m,
+		Payload: Payload{
+			Data: p,
+		},
+	}
+	switch payload := p.(type) {
+	case *github.PullRequestEvent:
+		payload.Repo = repository(m.Repo)
+
+		action := payload.GetAction()
+		if action == "closed" && payload.GetPullRequest().GetMerged() {
+			action = "merged"
+		}
+		if typ, ok := pullRequestTemplates[action]; ok && payload.PullRequest != nil {
+			e.Type = typ
+			e.Payload.AddLink("diff", payload.PullRequest.GetDiffURL())
+			return e, true
+		}
+	case *github.ReleaseEvent:
+		payload.Repo = repository(m.Repo)
+
+		// Webhooks are sent with both "published" and "prereleased" actions for pre-release.
+		if payload.GetAction() == "published" && payload.GetRelease().GetPrerelease() {
+			break
+		}
+		if typ, ok := releaseTemplates[payload.GetAction()]; ok && payload.Release != nil {
+			e.Type = typ
+			e.Payload.AddLink("Релиз", payload.Release.GetURL())
+			return e, true
+		}
+	case *github.PushEvent:
+		repo := repository(m.Repo)
+		payload.Repo = &github.PushEventRepository{
+			Name:    repo.Name,
+			HTMLURL: repo.HTMLURL,
+		}
+
+		// Branch filters are not applied to tags.
+		if branch := strings.TrimPrefix(payload.GetRef(), "refs/heads/"); branch != payload.GetRef() &&
+			!matchBranch(m.Branches, branch) {
+			break
+		}
+		e.Type = "push"
+		return e, true
+	case *github.IssuesEvent:
+		payload.Repo = repository(m.Repo)
+
+		if typ, ok := issueTemplates[payload.GetAction()]; ok && payload.Issue != nil {
+			e.Type = typ
+			e.Payload.AddLink("Issue", payload.Issue.GetURL())
+			return e, true
+		}
+	case *github.CreateEvent:
+		payload.Repo = repository(m.Repo)
+
+		switch payload.GetRefType() {
+		case "branch", "tag":
+			e.Type = "create"
+			e.Payload.AddLink(payload.GetRef(), m.Repo.ToGithubURL()+"/tree/"+payload.GetRef())
+			return e, true
+		}
+	case *github.DeleteEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.Ref != nil {
+			e.Type = "delete"
+			return e, true
+		}
+	case *github.ForkEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.Forkee != nil {
+			e.Type = "fork"
+			e.Payload.AddLink("Форк", payload.Forkee.GetHTMLURL())
+			return e, true
+		}
+	case *github.WatchEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.GetAction() == "started" {
+			e.Type = "star"
+			return e, true
+		}
+	case *github.MemberEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.GetAction() == "added" && payload.Member != nil {
+			e.Type = "member"
+			return e, true
+		}
+	case *github.PublicEvent:
+		payload.Repo = repository(m.Repo)
+
+		e.Type = "public"
+		e.Payload.AddLink("Репозиторий", m.Repo.ToGithubURL())
+		return e, true
+	case *github.GollumEvent:
+		payload.Repo = repository(m.Repo)
+
+		if len(payload.Pages) > 0 {
+			e.Type = "wiki"
+			for _, page := range payload.Pages {
+				e.Payload.AddLink(page.GetTitle(), page.GetHTMLURL())
 			}
+			return e, true
+		}
+	case *github.CheckSuiteEvent:
+		suite := payload.GetCheckSuite()
+		// Only failures on the default branch are reported.
+		onDefault := onDefaultBranch(payload.Repo, suite.GetHeadBranch())
+		payload.Repo = repository(m.Repo)
+
+		// Github Actions suites are reported as workflow runs.
+		if suite.GetApp().GetSlug() == actionsAppSlug {
+			break
+		}
+		if payload.GetAction() == "completed" && ciFailed(suite.GetConclusion()) && onDefault {
+			e.Type = "check_suite"
+			e.Payload.AddLink("Проверки", m.Repo.ToGithubURL()+"/commit/"+suite.GetHeadSHA()+"/checks")
+			return e, true
+		}
+	case *WorkflowRunEvent:
+		onDefault := onDefaultBranch(payload.Repo, payload.WorkflowRun.HeadBranch)
+		payload.Repo = repository(m.Repo)
+
+		if payload.Action == "completed" && ciFailed(payload.WorkflowRun.Conclusion) && onDefault {
+			e.Type = "workflow_run"
+			e.Payload.AddLink("Запуск", payload.WorkflowRun.HTMLURL)
+			return e, true
+		}
+	case *github.IssueCommentEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.GetAction() == "created" && payload.Issue != nil && payload.Comment != nil {
+			e.Type = "issue_comment"
+			e.Payload.AddLink("Комментарий", payload.Comment.GetHTMLURL())
+			return e, true
+		}
+	case *github.PullRequestReviewEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.GetAction() != "submitted" || payload.PullRequest == nil || payload.Review == nil {
+			break
+		}
+		// Events API returns upper case state, webhooks return lower case.
+		state := strings.ToLower(payload.Review.GetState())
+		switch state {
+		case "approved", "changes_requested", "commented":
+			payload.Review.State = &state
+			e.Type = "pr_review"
+			e.Payload.AddLink("Ревью", payload.Review.GetHTMLURL())
+			return e, true
+		}
+	case *github.PullRequestReviewCommentEvent:
+		payload.Repo = repository(m.Repo)
+
+		if payload.GetAction() == "created" && payload.PullRequest != nil && payload.Comment != nil {
+			e.Type = "pr_review_comment"
+			e.Payload.AddLink("Комментарий", payload.Comment.GetHTMLURL())
+			return e, true
 		}
 	}
 
-	if c == 0 {
-		s.log.Info("No new events")
+	return Event{}, false
+}
+
+// deliver calls handler and marks event as delivered to the mapping peer.
+// Kind is a namespace of event ID in seen storage.
+//
+// If handler error is permanent or delivery failed maxDeliveryAttempts times,
+// event is skipped and marked as seen, so later events are not blocked by it.
+func (s *Listener) deliver(ctx context.Context, kind storage.SeenKind, eventID int64, e Event) error {
+	key := deliveryKey{
+		Kind:     kind,
+		Repo:     e.Mapping.Repo,
+		PeerType: e.Mapping.Peer.PeerType,
+		PeerID:   e.Mapping.Peer.ID,
+		EventID:  eventID,
 	}
 
-	return nil
+	if err := s.handler(ctx, e); err != nil {
+		s.attempts[key]++
+		attempts := s.attempts[key]
+		if !IsPermanent(err) && attempts < maxDeliveryAttempts {
+			return err
+		}
+
+		s.log.Warn("Skipping undeliverable event",
+			zap.String("repo", e.Mapping.Repo.ToGithubURL()),
+			zap.Int("peer_id", e.Mapping.Peer.ID),
+			zap.String("event_type", e.Type),
+			zap.Int("attempts", attempts),
+			zap.Error(err),
+		)
+	}
+	delete(s.attempts, key)
+
+	return s.seen.MarkSeen(ctx, kind, e.Mapping.Repo, e.Mapping.Peer, eventID)
 }
@@ -0,0 +1,1048 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+type fakeEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// fakeGithub serves repository events API, returning pages in order.
+type fakeGithub struct {
+	pages [][]fakeEvent
+	mux   sync.Mutex
+}
+
+func (f *fakeGithub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/repos/owner/repo/events" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	var page []fakeEvent
+	if len(f.pages) > 0 {
+		page, f.pages = f.pages[0], f.pages[1:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// newTestClient returns client of fake Github API server, which is closed after test.
+func newTestClient(t *testing.T, api http.Handler) *github.Client {
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(srv.Client())
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+// newTestListener creates listener of fake Github API, which stores cursors
+// and delivered events in given storage.
+func newTestListener(
+	t *testing.T,
+	api http.Handler,
+	store *storage.InMemoryStorage,
+	handler Handler,
+	opts ...func(*Listener),
+) Listener {
+	opts = append([]func(*Listener){
+		WithCursorStorage(store),
+		WithSeenStorage(store),
+		WithLogger(zap.NewNop()),
+	}, opts...)
+	return NewListener(StaticClient(newTestClient(t, api)), store, handler, opts...)
+}
+
+func newFakeEvent(id int, typ string, createdAt time.Time, payload string) fakeEvent {
+	return fakeEvent{
+		ID:        fmt.Sprint(id),
+		Type:      typ,
+		CreatedAt: createdAt,
+		Payload:   json.RawMessage(payload),
+	}
+}
+
+func TestListenerDeliversAllEvents(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(minutes int) time.Time {
+		return now.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	// Pages are in reverse chronological order as Github returns them.
+	gh := &fakeGithub{pages: [][]fakeEvent{
+		{
+			newFakeEvent(105, "IssuesEvent", at(-1), `{"action":"opened","issue":{"number":2}}`),
+			newFakeEvent(104, "WatchEvent", at(-2), `{"action":"started"}`),
+			newFakeEvent(103, "PushEvent", at(-3), `{"ref":"refs/heads/master"}`),
+			newFakeEvent(102, "PullRequestEvent", at(-4), `{"action":"closed","pull_request":{"number":1}}`),
+			newFakeEvent(101, "PullRequestEvent", at(-5), `{"action":"opened","pull_request":{"number":1}}`),
+			// Before cursor.
+			newFakeEvent(100, "PushEvent", at(-60), `{"ref":"refs/heads/master"}`),
+		},
+		{
+			newFakeEvent(107, "ReleaseEvent", at(0), `{"action":"published","release":{"name":"v1"}}`),
+			newFakeEvent(106, "PushEvent", at(0), `{"ref":"refs/heads/dev"}`),
+			// Already delivered.
+			newFakeEvent(105, "IssuesEvent", at(-1), `{"action":"opened","issue":{"number":2}}`),
+			newFakeEvent(104, "WatchEvent", at(-2), `{"action":"started"}`),
+		},
+	}}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	peers := []storage.Peer{
+		{PeerType: storage.Chat, ID: 1},
+		{PeerType: storage.Channel, ID: 2},
+	}
+	for _, peer := range peers {
+		a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: peer}))
+	}
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 100, CreatedAt: at(-60)}))
+
+	delivered := map[storage.Peer][]string{}
+	handler := func(ctx context.Context, e Event) error {
+		var id string
+		switch p := e.Payload.Data.(type) {
+		case *github.PullRequestEvent:
+			id = fmt.Sprintf("pr#%d", p.GetPullRequest().GetNumber())
+		case *github.IssuesEvent:
+			id = fmt.Sprintf("issue#%d", p.GetIssue().GetNumber())
+		case *github.PushEvent:
+			id = p.GetRef()
+		case *github.ReleaseEvent:
+			id = p.GetRelease().GetName()
+		}
+		delivered[e.Mapping.Peer] = append(delivered[e.Mapping.Peer], e.Type+":"+id)
+		return nil
+	}
+
+	l := newTestListener(t, gh, store, handler)
+
+	a.NoError(l.poll(ctx))
+	for _, peer := range peers {
+		a.Equal([]string{
+			"pr:pr#1",
+			"pr_closed:pr#1",
+			"push:refs/heads/master",
+			"issue:issue#2",
+		}, delivered[peer])
+	}
+
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(105), cursor.EventID)
+
+	// Allow immediate poll.
+	l.states[repo].nextPoll = time.Time{}
+	delivered = map[storage.Peer][]string{}
+
+	a.NoError(l.poll(ctx))
+	for _, peer := range peers {
+		a.Equal([]string{
+			"push:refs/heads/dev",
+			"release:v1",
+		}, delivered[peer])
+	}
+}
+
+func TestListenerRetriesFailedEvents(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	page := []fakeEvent{
+		newFakeEvent(4, "PushEvent", now, `{"ref":"refs/heads/c"}`),
+		newFakeEvent(3, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/b"}`),
+		newFakeEvent(2, "PushEvent", now.Add(-2*time.Minute), `{"ref":"refs/heads/a"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-3*time.Minute), `{"ref":"refs/heads/old"}`),
+	}
+	api := &fakeGithub{pages: [][]fakeEvent{page, page}}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-3 * time.Minute)}))
+
+	var delivered []string
+	fail := true
+	handler := func(ctx context.Context, e Event) error {
+		ref := e.Payload.Data.(*github.PushEvent).GetRef()
+		if ref == "refs/heads/b" && fail {
+			fail = false
+			return fmt.Errorf("test error")
+		}
+		delivered = append(delivered, ref)
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler)
+
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/a"}, delivered)
+
+	l.states[repo].nextPoll = time.Time{}
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/a", "refs/heads/b", "refs/heads/c"}, delivered)
+}
+
+func TestListenerRestart(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	older := []fakeEvent{
+		newFakeEvent(2, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/a"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-2*time.Minute), `{"ref":"refs/heads/old"}`),
+	}
+	newer := append([]fakeEvent{
+		newFakeEvent(3, "PushEvent", now, `{"ref":"refs/heads/b"}`),
+	}, older...)
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-2 * time.Minute)}))
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		delivered = append(delivered, e.Payload.Data.(*github.PushEvent).GetRef())
+		return nil
+	}
+
+	l := newTestListener(t, &fakeGithub{pages: [][]fakeEvent{older}}, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/a"}, delivered)
+
+	// Restarted listener resumes from stored cursor.
+	l = newTestListener(t, &fakeGithub{pages: [][]fakeEvent{newer}}, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/a", "refs/heads/b"}, delivered)
+
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(3), cursor.EventID)
+}
+
+func TestListenerMaxCatchUp(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	page := []fakeEvent{
+		newFakeEvent(3, "PushEvent", now.Add(-time.Hour), `{"ref":"refs/heads/new"}`),
+		newFakeEvent(2, "PushEvent", now.Add(-30*time.Hour), `{"ref":"refs/heads/old"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-48*time.Hour), `{"ref":"refs/heads/cursor"}`),
+	}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	// Listener was stopped two days ago.
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-48 * time.Hour)}))
+
+	var (
+		delivered []string
+		gaps      []EventsGap
+	)
+	handler := func(ctx context.Context, e Event) error {
+		switch data := e.Payload.Data.(type) {
+		case EventsGap:
+			gaps = append(gaps, data)
+		case *github.PushEvent:
+			delivered = append(delivered, data.GetRef())
+		}
+		return nil
+	}
+
+	start := time.Now()
+	l := newTestListener(t, &fakeGithub{pages: [][]fakeEvent{page}}, store, handler,
+		WithMaxCatchUp(24*time.Hour),
+	)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/new"}, delivered)
+	a.Len(gaps, 1)
+	a.True(gaps[0].Since.Equal(now.Add(-48 * time.Hour)))
+	a.False(gaps[0].Until.Before(start.Add(-24 * time.Hour)))
+
+	// Gap is not reported again after restart.
+	l = newTestListener(t, &fakeGithub{pages: [][]fakeEvent{page}}, store, handler,
+		WithMaxCatchUp(24*time.Hour),
+	)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/new"}, delivered)
+	a.Len(gaps, 1)
+}
+
+func TestListenerPrunesAttempts(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	page := []fakeEvent{
+		newFakeEvent(2, "PushEvent", now, `{"ref":"refs/heads/a"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/old"}`),
+	}
+	gh := &fakeGithub{pages: [][]fakeEvent{page}}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	kept := storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}
+	removed := storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 2}}
+	owner := storage.Mapping{Repo: storage.Repo{Owner: "owner"}, Peer: storage.Peer{ID: 3}}
+	store := storage.NewInMemoryStorage()
+	for _, m := range []storage.Mapping{kept, removed} {
+		a.NoError(store.Add(ctx, m))
+	}
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-time.Minute)}))
+
+	handler := func(ctx context.Context, e Event) error {
+		return fmt.Errorf("test error")
+	}
+	l := newTestListener(t, gh, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Len(l.attempts, 2)
+
+	// Attempt of owner subscription is kept while owner mapping exists.
+	ownerKey := deliveryKey{Kind: storage.SeenEvents, Repo: repo, PeerID: owner.Peer.ID, EventID: 2}
+	l.attempts[ownerKey] = 1
+	a.NoError(store.Remove(ctx, removed))
+	a.NoError(store.Add(ctx, owner))
+	mappings, err := store.List(ctx)
+	a.NoError(err)
+	l.pruneAttempts(mappings)
+	a.Equal(map[deliveryKey]int{
+		{Kind: storage.SeenEvents, Repo: repo, PeerID: kept.Peer.ID, EventID: 2}: 1,
+		ownerKey: 1,
+	}, l.attempts)
+}
+
+func TestListenerSkipsUndeliverableEvents(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	page := []fakeEvent{
+		newFakeEvent(4, "PushEvent", now, `{"ref":"refs/heads/c"}`),
+		newFakeEvent(3, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/b"}`),
+		newFakeEvent(2, "PushEvent", now.Add(-2*time.Minute), `{"ref":"refs/heads/a"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-3*time.Minute), `{"ref":"refs/heads/old"}`),
+	}
+	gh := &fakeGithub{}
+	for i := 0; i < maxDeliveryAttempts; i++ {
+		gh.pages = append(gh.pages, page)
+	}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	blocked, failing := storage.Peer{ID: 1}, storage.Peer{ID: 2}
+	store := storage.NewInMemoryStorage()
+	for _, peer := range []storage.Peer{blocked, failing} {
+		a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: peer}))
+	}
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-3 * time.Minute)}))
+
+	delivered := map[storage.Peer][]string{}
+	handler := func(ctx context.Context, e Event) error {
+		ref := e.Payload.Data.(*github.PushEvent).GetRef()
+		if ref == "refs/heads/b" {
+			if e.Mapping.Peer == blocked {
+				return Permanent(fmt.Errorf("blocked"))
+			}
+			return fmt.Errorf("test error")
+		}
+		delivered[e.Mapping.Peer] = append(delivered[e.Mapping.Peer], ref)
+		return nil
+	}
+
+	l := newTestListener(t, gh, store, handler)
+
+	// Permanently failed event is skipped at once.
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"refs/heads/a", "refs/heads/c"}, delivered[blocked])
+	a.Equal([]string{"refs/heads/a"}, delivered[failing])
+
+	// Transiently failed event is retried, then skipped.
+	for i := 1; i < maxDeliveryAttempts; i++ {
+		cursor, err := store.GetCursor(ctx, repo)
+		a.NoError(err)
+		a.Equal(int64(1), cursor.EventID)
+
+		l.states[repo].nextPoll = time.Time{}
+		a.NoError(l.poll(ctx))
+	}
+	a.Equal([]string{"refs/heads/a", "refs/heads/c"}, delivered[blocked])
+	a.Equal([]string{"refs/heads/a", "refs/heads/c"}, delivered[failing])
+	a.Empty(l.attempts)
+
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(4), cursor.EventID)
+}
+
+func TestListenerPrerelease(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	api := &fakeGithub{pages: [][]fakeEvent{{
+		newFakeEvent(3, "ReleaseEvent", now, `{"action":"published","release":{"name":"v1"}}`),
+		newFakeEvent(2, "ReleaseEvent", now.Add(-time.Minute), `{"action":"published","release":{"name":"v1-rc","prerelease":true}}`),
+		newFakeEvent(1, "PushEvent", now.Add(-time.Hour), `{"ref":"refs/heads/master"}`),
+	}}}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-time.Hour)}))
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		name := e.Payload.Data.(*github.ReleaseEvent).GetRelease().GetName()
+		delivered = append(delivered, e.Type+":"+name)
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"release_prereleased:v1-rc", "release:v1"}, delivered)
+}
+
+// paginatedGithub serves repository events API with pagination.
+type paginatedGithub struct {
+	events   []fakeEvent
+	requests int
+}
+
+func (f *paginatedGithub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests++
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 30
+	}
+
+	start, end := (page-1)*perPage, page*perPage
+	// Github returns at most 300 events.
+	total := len(f.events)
+	if total > maxEvents {
+		total = maxEvents
+	}
+	if end >= total {
+		end = total
+	} else {
+		next := fmt.Sprintf("%s?page=%d&per_page=%d", r.URL.Path, page+1, perPage)
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next))
+	}
+	if start > end {
+		start = end
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(f.events[start:end])
+}
+
+func TestListenerPaginates(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, tt := range []struct {
+		name      string
+		total     int
+		requests  int
+		delivered int
+		gap       bool
+	}{
+		{"OnePage", 50, 1, 49, false},
+		{"ThreePages", 250, 3, 249, false},
+		{"Gap", 350, 3, maxEvents, true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			ctx := context.Background()
+
+			gh := &paginatedGithub{}
+			for id := tt.total; id >= 1; id-- {
+				createdAt := now.Add(time.Duration(id-tt.total) * time.Second)
+				gh.events = append(gh.events, newFakeEvent(id, "PushEvent", createdAt, `{"ref":"refs/heads/master"}`))
+			}
+
+			repo := storage.Repo{Owner: "owner", Name: "repo"}
+			store := storage.NewInMemoryStorage()
+			a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+			a.NoError(store.SetCursor(ctx, repo, storage.Cursor{
+				EventID:   1,
+				CreatedAt: now.Add(time.Duration(1-tt.total) * time.Second),
+			}))
+
+			delivered, gap := 0, false
+			handler := func(ctx context.Context, e Event) error {
+				switch e.Type {
+				case "push":
+					delivered++
+				case "events_gap":
+					gap = true
+				}
+				return nil
+			}
+
+			l := newTestListener(t, gh, store, handler)
+			a.NoError(l.poll(ctx))
+			a.Equal(tt.requests, gh.requests)
+			a.Equal(tt.delivered, delivered)
+			a.Equal(tt.gap, gap)
+
+			cursor, err := store.GetCursor(ctx, repo)
+			a.NoError(err)
+			a.Equal(int64(tt.total), cursor.EventID)
+		})
+	}
+}
+
+func TestListenerReportsGapOnce(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	const total = 350
+	gh := &paginatedGithub{}
+	for id := total; id >= 1; id-- {
+		createdAt := now.Add(time.Duration(id-total) * time.Second)
+		gh.events = append(gh.events, newFakeEvent(id, "PushEvent", createdAt, `{"ref":"refs/heads/master"}`))
+	}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{
+		EventID:   1,
+		CreatedAt: now.Add(time.Duration(1-total) * time.Second),
+	}))
+
+	gaps := 0
+	handler := func(ctx context.Context, e Event) error {
+		if e.Type == "events_gap" {
+			gaps++
+			return nil
+		}
+		// Keep cursor to refetch the same events.
+		return fmt.Errorf("test error")
+	}
+
+	l := newTestListener(t, gh, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Equal(1, gaps)
+
+	l.states[repo].nextPoll = time.Time{}
+	a.NoError(l.poll(ctx))
+	a.Equal(1, gaps)
+
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(1), cursor.EventID)
+}
+
+func TestNewEvent(t *testing.T) {
+	m := storage.Mapping{Repo: storage.Repo{Owner: "owner", Name: "repo"}}
+	tests := []struct {
+		name    string
+		typ     string
+		payload string
+		want    string
+	}{
+		{"PROpened", "PullRequestEvent",
+			`{"action":"opened","pull_request":{"number":1}}`,
+			"pr"},
+		{"PRMerged", "PullRequestEvent",
+			`{"action":"closed","pull_request":{"number":1,"merged":true}}`,
+			"pr_merged"},
+		{"PRClosed", "PullRequestEvent",
+			`{"action":"closed","pull_request":{"number":1}}`,
+			"pr_closed"},
+		{"PRSynchronize", "PullRequestEvent",
+			`{"action":"synchronize","pull_request":{"number":1}}`,
+			""},
+		{"IssueLabeled", "IssuesEvent",
+			`{"action":"labeled","issue":{"number":1},"label":{"name":"bug"}}`,
+			"issue_labeled"},
+		{"ReleasePublished", "ReleaseEvent",
+			`{"action":"published","release":{"name":"v1"}}`,
+			"release"},
+		{"PrereleasePublished", "ReleaseEvent",
+			`{"action":"published","release":{"name":"v1-rc","prerelease":true}}`,
+			""},
+		{"Prereleased", "ReleaseEvent",
+			`{"action":"prereleased","release":{"name":"v1-rc","prerelease":true}}`,
+			"release_prereleased"},
+		{"IssueComment", "IssueCommentEvent",
+			`{"action":"created","issue":{"number":1},"comment":{"html_url":"https://github.com/owner/repo/issues/1#issuecomment-1"}}`,
+			"issue_comment"},
+		{"IssueCommentEdited", "IssueCommentEvent",
+			`{"action":"edited","issue":{"number":1},"comment":{}}`,
+			""},
+		{"ReviewApproved", "PullRequestReviewEvent",
+			`{"action":"submitted","pull_request":{"number":1},"review":{"state":"APPROVED"}}`,
+			"pr_review"},
+		{"ReviewChangesRequested", "PullRequestReviewEvent",
+			`{"action":"submitted","pull_request":{"number":1},"review":{"state":"changes_requested"}}`,
+			"pr_review"},
+		{"ReviewDismissed", "PullRequestReviewEvent",
+			`{"action":"submitted","pull_request":{"number":1},"review":{"state":"dismissed"}}`,
+			""},
+		{"CheckSuiteFailed", "CheckSuiteEvent",
+			`{"action":"completed","check_suite":{"head_branch":"main","conclusion":"failure","app":{"slug":"ci"}},"repository":{"default_branch":"main"}}`,
+			"check_suite"},
+		{"CheckSuiteFailedOtherBranch", "CheckSuiteEvent",
+			`{"action":"completed","check_suite":{"head_branch":"feature","conclusion":"failure","app":{"slug":"ci"}},"repository":{"default_branch":"main"}}`,
+			""},
+		{"ReviewComment", "PullRequestReviewCommentEvent",
+			`{"action":"created","pull_request":{"number":1},"comment":{"path":"main.go"}}`,
+			"pr_review_comment"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			a := require.New(t)
+			raw := json.RawMessage(test.payload)
+			p, err := (&github.Event{Type: &test.typ, RawPayload: &raw}).ParsePayload()
+			a.NoError(err)
+
+			e, ok := NewEvent(m, p)
+			a.Equal(test.want != "", ok)
+			a.Equal(test.want, e.Type)
+		})
+	}
+}
+
+func TestNewEventKinds(t *testing.T) {
+	a := require.New(t)
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	typ := "WatchEvent"
+	raw := json.RawMessage(`{"action":"started"}`)
+
+	// Noisy kinds are disabled by default.
+	p, err := (&github.Event{Type: &typ, RawPayload: &raw}).ParsePayload()
+	a.NoError(err)
+	_, ok := NewEvent(storage.Mapping{Repo: repo}, p)
+	a.False(ok)
+
+	p, err = (&github.Event{Type: &typ, RawPayload: &raw}).ParsePayload()
+	a.NoError(err)
+	e, ok := NewEvent(storage.Mapping{Repo: repo, Kinds: []string{storage.KindStar}}, p)
+	a.True(ok)
+	a.Equal("star", e.Type)
+}
+
+func TestListenerKinds(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	api := &fakeGithub{pages: [][]fakeEvent{{
+		newFakeEvent(3, "IssuesEvent", now, `{"action":"opened","issue":{"number":1}}`),
+		newFakeEvent(2, "PushEvent", now.Add(-time.Minute), `{"ref":"refs/heads/master"}`),
+		newFakeEvent(1, "PushEvent", now.Add(-time.Hour), `{"ref":"refs/heads/master"}`),
+	}}}
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	m := storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}
+	m.SetKind(storage.KindPush, false)
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, m))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-time.Hour)}))
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		delivered = append(delivered, e.Type)
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler)
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"issue"}, delivered)
+}
+
+func TestListenerWorkflowRuns(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	runs := []WorkflowRun{
+		{ID: 1, Name: "CI", HeadBranch: "main", Conclusion: "failure", UpdatedAt: now.Add(-time.Hour)},
+	}
+	events := "[]"
+	var mux sync.Mutex
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/owner/repo":
+			_, _ = w.Write([]byte(`{"name":"repo","default_branch":"main"}`))
+		case "/repos/owner/repo/events":
+			_, _ = w.Write([]byte(events))
+		case "/repos/owner/repo/actions/runs":
+			a.Equal("completed", r.URL.Query().Get("status"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"workflow_runs": runs})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		run := e.Payload.Data.(*WorkflowRunEvent).WorkflowRun
+		delivered = append(delivered, fmt.Sprintf("%s:%d", e.Type, run.ID))
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler,
+		WithWorkflowRuns(true),
+	)
+
+	// Existing runs are skipped.
+	a.NoError(l.poll(ctx))
+	a.Empty(delivered)
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.True(cursor.WorkflowRunsUpdatedAt.Equal(now.Add(-time.Hour)))
+
+	mux.Lock()
+	runs = append([]WorkflowRun{
+		{ID: 4, Name: "CI", HeadBranch: "main", Conclusion: "success", UpdatedAt: now},
+		// Failures on other branches are not reported.
+		{ID: 3, Name: "CI", HeadBranch: "dependabot/npm/x", Conclusion: "failure", UpdatedAt: now.Add(-time.Minute)},
+		{ID: 2, Name: "CI", HeadBranch: "main", Conclusion: "failure", UpdatedAt: now.Add(-2 * time.Minute)},
+	}, runs...)
+	// New events must not reset workflow runs cursor.
+	events = fmt.Sprintf(`[{"id":"1","type":"WatchEvent","created_at":%q,"payload":{"action":"started"}}]`,
+		now.Format(time.RFC3339))
+	mux.Unlock()
+	l.states[repo].nextPoll = time.Time{}
+
+	a.NoError(l.poll(ctx))
+	a.Equal([]string{"workflow_run:2"}, delivered)
+	cursor, err = store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.True(cursor.WorkflowRunsUpdatedAt.Equal(now))
+}
+
+func TestListenerWorkflowRunsRetry(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	runs := []WorkflowRun{
+		{ID: 2, Name: "CI", HeadBranch: "main", Conclusion: "failure", UpdatedAt: now},
+	}
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/owner/repo":
+			_, _ = w.Write([]byte(`{"name":"repo","default_branch":"main"}`))
+		case "/repos/owner/repo/events":
+			_, _ = w.Write([]byte("[]"))
+		case "/repos/owner/repo/actions/runs":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"workflow_runs": runs})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	ok, failing := storage.Peer{ID: 1}, storage.Peer{ID: 2}
+	store := storage.NewInMemoryStorage()
+	for _, peer := range []storage.Peer{ok, failing} {
+		a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: peer}))
+	}
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{
+		CreatedAt:             now.Add(-time.Hour),
+		WorkflowRunsUpdatedAt: now.Add(-time.Hour),
+	}))
+
+	delivered := map[storage.Peer]int{}
+	handler := func(ctx context.Context, e Event) error {
+		if e.Mapping.Peer == failing {
+			return fmt.Errorf("test error")
+		}
+		delivered[e.Mapping.Peer]++
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler,
+		WithWorkflowRuns(true),
+	)
+	for i := 0; i < maxDeliveryAttempts; i++ {
+		if state, ok := l.states[repo]; ok {
+			state.nextPoll = time.Time{}
+		}
+		a.NoError(l.poll(ctx))
+	}
+
+	// Run is delivered once while it is retried for failing peer.
+	a.Equal(map[storage.Peer]int{ok: 1}, delivered)
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.True(cursor.WorkflowRunsUpdatedAt.Equal(now))
+}
+
+func TestListenerWorkflowRunsForbidden(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	runsRequests := 0
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/repos/owner/repo/events":
+			_, _ = fmt.Fprintf(w, `[
+				{"id":"2","type":"WatchEvent","created_at":%q,"payload":{"action":"started"}},
+				{"id":"1","type":"WatchEvent","created_at":%q,"payload":{"action":"started"}}
+			]`, now.Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339))
+		case "/repos/owner/repo/actions/runs":
+			runsRequests++
+			http.Error(w, `{"message":"Resource not accessible by integration"}`, http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	repo := storage.Repo{Owner: "owner", Name: "repo"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}, Kinds: []string{storage.KindStar}}))
+	a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 1, CreatedAt: now.Add(-time.Hour)}))
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		delivered = append(delivered, e.Type)
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler,
+		WithWorkflowRuns(true),
+	)
+	a.NoError(l.poll(ctx))
+
+	// Events are delivered and repository stays available.
+	a.Equal([]string{"star"}, delivered)
+	a.False(l.states[repo].unavailable)
+	cursor, err := store.GetCursor(ctx, repo)
+	a.NoError(err)
+	a.Equal(int64(2), cursor.EventID)
+	a.False(cursor.Unavailable)
+
+	// Workflow runs are not requested until retry delay passes.
+	l.states[repo].nextPoll = time.Time{}
+	a.NoError(l.poll(ctx))
+	a.Equal(1, runsRequests)
+}
+
+func TestNewEventBranches(t *testing.T) {
+	a := require.New(t)
+	m := storage.Mapping{
+		Repo:     storage.Repo{Owner: "owner", Name: "repo"},
+		Branches: []string{"!dependabot/**"},
+	}
+
+	for ref, ok := range map[string]bool{
+		"refs/heads/main":              true,
+		"refs/heads/dependabot/npm/x":  false,
+		"refs/tags/dependabot/npm/tag": true,
+	} {
+		ref := ref
+		_, delivered := NewEvent(m, &github.PushEvent{Ref: &ref})
+		a.Equal(ok, delivered, ref)
+	}
+}
+
+func TestListenerOwner(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	event := func(id int, repo, typ, payload string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":         fmt.Sprint(id),
+			"type":       typ,
+			"created_at": now,
+			"repo":       map[string]string{"name": repo},
+			"payload":    json.RawMessage(payload),
+		}
+	}
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var resp interface{}
+		switch r.URL.Path {
+		case "/users/org":
+			resp = map[string]string{"login": "org", "type": "Organization"}
+		case "/orgs/org/repos":
+			a.Equal("private", r.URL.Query().Get("type"))
+			resp = []map[string]interface{}{
+				{"name": "secret", "owner": map[string]string{"login": "org"}},
+			}
+		case "/orgs/org/events":
+			resp = []interface{}{
+				event(101, "org/public", "IssuesEvent", `{"action":"opened","issue":{"number":1}}`),
+				event(100, "org/public", "WatchEvent", `{"action":"started"}`),
+			}
+		case "/repos/org/secret/events":
+			resp = []interface{}{
+				event(102, "org/secret", "IssuesEvent", `{"action":"opened","issue":{"number":2}}`),
+				event(100, "org/secret", "WatchEvent", `{"action":"started"}`),
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	owner := storage.Repo{Owner: "org"}
+	secret := storage.Repo{Owner: "org", Name: "secret"}
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{Repo: owner, Peer: storage.Peer{ID: 1}}))
+	for _, repo := range []storage.Repo{owner, secret} {
+		a.NoError(store.SetCursor(ctx, repo, storage.Cursor{EventID: 100, CreatedAt: now.Add(-time.Hour)}))
+	}
+
+	var delivered []string
+	handler := func(ctx context.Context, e Event) error {
+		issue := e.Payload.Data.(*github.IssuesEvent).GetIssue()
+		delivered = append(delivered, fmt.Sprintf("%s#%d", e.Mapping.Repo.ToGithubURL(), issue.GetNumber()))
+		return nil
+	}
+
+	l := newTestListener(t, api, store, handler)
+
+	a.NoError(l.poll(ctx))
+	a.ElementsMatch([]string{
+		"https://github.com/org/public#1",
+		"https://github.com/org/secret#2",
+	}, delivered)
+}
+
+func TestListenerOwnerResolveRetry(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	userRequests := 0
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/users/org":
+			userRequests++
+			if userRequests == 1 {
+				http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"login":"org","type":"Organization"}`))
+		case "/orgs/org/repos":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	owner := storage.Repo{Owner: "org"}
+	l := newTestListener(t, api, storage.NewInMemoryStorage(), nil)
+
+	// Failed resolution is retried on next poll, not after listing interval.
+	state, err := l.expandOwner(ctx, owner)
+	a.Error(err)
+	a.False(state.org)
+
+	state, err = l.expandOwner(ctx, owner)
+	a.NoError(err)
+	a.True(state.org)
+	a.Equal(2, userRequests)
+
+	// Resolved owner is not listed again until interval passes.
+	_, err = l.expandOwner(ctx, owner)
+	a.NoError(err)
+	a.Equal(2, userRequests)
+}
+
+func TestListenerRateLimitPerClient(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	reset := time.Now().Add(time.Hour).Unix()
+
+	newClient := func(remaining int, requests *int) *github.Client {
+		return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*requests++
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			_, _ = w.Write([]byte("[]"))
+		}))
+	}
+	var exhaustedRequests, requests int
+	exhausted := newClient(0, &exhaustedRequests)
+	available := newClient(4000, &requests)
+
+	store := storage.NewInMemoryStorage()
+	repos := []storage.Repo{
+		{Host: "exhausted.example.com", Owner: "owner", Name: "repo"},
+		{Host: "available.example.com", Owner: "owner", Name: "repo"},
+	}
+	for _, repo := range repos {
+		a.NoError(store.Add(ctx, storage.Mapping{Repo: repo, Peer: storage.Peer{ID: 1}}))
+	}
+
+	l := NewListener(HostClients(map[string]Clients{
+		"exhausted.example.com": StaticClient(exhausted),
+		"available.example.com": StaticClient(available),
+	}), store, func(ctx context.Context, e Event) error {
+		return nil
+	},
+		WithCursorStorage(store),
+		WithSeenStorage(store),
+		WithLogger(zap.NewNop()),
+	)
+
+	for i := 0; i < 3; i++ {
+		for _, repo := range repos {
+			if state, ok := l.states[repo]; ok {
+				state.nextPoll = time.Time{}
+			}
+		}
+		a.NoError(l.poll(ctx))
+	}
+	a.Equal(1, exhaustedRequests)
+	a.Equal(3, requests)
+}
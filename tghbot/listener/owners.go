@@ -0,0 +1,173 @@
+package listener
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// ownerReposInterval is an interval of owner repositories listing,
+// so new repositories are picked up.
+const ownerReposInterval = 15 * time.Minute
+
+// ownerState is a state of organization or user subscription.
+type ownerState struct {
+	// org whether owner is an organization.
+	org bool
+	// repos are repositories polled separately, because they are not in organization events.
+	repos []storage.Repo
+	// nextList is the earliest time of next repositories listing.
+	nextList time.Time
+	// resolved whether owner type is known.
+	resolved bool
+}
+
+func (s *Listener) ownerState(owner storage.Repo) *ownerState {
+	state, ok := s.owners[owner]
+	if !ok {
+		state = &ownerState{}
+		s.owners[owner] = state
+	}
+	return state
+}
+
+// expandOwner returns repositories of owner which should be polled separately.
+//
+// Public events of organization repositories, including created later, are fetched
+// using organization events API, so only private repositories are returned.
+// Github has no such API for users, so all user repositories are returned.
+// Repositories are listed periodically, last known list is used on failure.
+func (s *Listener) expandOwner(ctx context.Context, owner storage.Repo) (*ownerState, error) {
+	state := s.ownerState(owner)
+	if state.resolved && time.Now().Before(state.nextList) {
+		return state, nil
+	}
+
+	gh, err := s.clients.Client(ctx, owner)
+	if err != nil {
+		return state, err
+	}
+
+	// Owner type is resolved on every poll until success, otherwise
+	// organization events would not be polled until next listing.
+	if !state.resolved {
+		user, resp, err := gh.Users.Get(ctx, owner.Owner)
+		if resp != nil {
+			s.updateRate(gh, resp)
+		}
+		if err != nil {
+			return state, err
+		}
+		state.org = user.GetType() == "Organization"
+		state.resolved = true
+	}
+	// Do not retry failed listing on every poll.
+	state.nextList = time.Now().Add(ownerReposInterval)
+
+	var repos []storage.Repo
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		var (
+			page []*github.Repository
+			resp *github.Response
+		)
+		if state.org {
+			// Only private repositories visible to the client are returned.
+			page, resp, err = gh.Repositories.ListByOrg(ctx, owner.Owner, &github.RepositoryListByOrgOptions{
+				Type:        "private",
+				ListOptions: opts,
+			})
+		} else {
+			page, resp, err = gh.Repositories.List(ctx, owner.Owner, &github.RepositoryListOptions{
+				Type:        "owner",
+				ListOptions: opts,
+			})
+		}
+		if resp != nil {
+			s.updateRate(gh, resp)
+		}
+		if err != nil {
+			return state, err
+		}
+
+		for _, repo := range page {
+			repos = append(repos, storage.Repo{
+				Host:  owner.Host,
+				Owner: repo.GetOwner().GetLogin(),
+				Name:  repo.GetName(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	state.repos = repos
+	return state, nil
+}
+
+// expandSubscriptions adds subscriptions to repositories of subscribed owners.
+// It returns owners which events should be polled using organization events API.
+func (s *Listener) expandSubscriptions(
+	ctx context.Context,
+	repos map[storage.Repo][]storage.Mapping,
+) map[storage.Repo]bool {
+	var owners []storage.Repo
+	for repo := range repos {
+		if repo.IsOwner() {
+			owners = append(owners, repo)
+		}
+	}
+
+	orgs := map[storage.Repo]bool{}
+	for _, owner := range owners {
+		subscribers := repos[owner]
+		state, err := s.expandOwner(ctx, owner)
+		if err != nil {
+			if ctx.Err() != nil {
+				return orgs
+			}
+			s.log.Error("Failed to list owner repositories",
+				zap.String("owner", owner.ToGithubURL()),
+				zap.Error(err),
+			)
+		}
+		if state.org {
+			orgs[owner] = true
+		}
+
+		for _, repo := range state.repos {
+			for _, m := range subscribers {
+				m.Repo = repo
+				repos[repo] = append(repos[repo], m)
+			}
+		}
+	}
+
+	for owner := range s.owners {
+		if _, ok := repos[owner]; !ok {
+			delete(s.owners, owner)
+		}
+	}
+	return orgs
+}
+
+// eventRepo returns repository of organization event.
+func eventRepo(owner storage.Repo, event *github.Event) (storage.Repo, bool) {
+	parts := strings.SplitN(event.GetRepo().GetName(), "/", 2)
+	if len(parts) != 2 {
+		return storage.Repo{}, false
+	}
+
+	return storage.Repo{
+		Host:  owner.Host,
+		Owner: parts[0],
+		Name:  parts[1],
+	}, true
+}
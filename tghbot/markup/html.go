@@ -0,0 +1,171 @@
+// Package markup converts formatted text to Telegram message entities.
+package markup
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+	"golang.org/x/net/html"
+)
+
+// utf16Len returns length of string in UTF-16 code units.
+// Telegram entity offsets and lengths are measured in them.
+func utf16Len(s string) (n int) {
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// element is a formatting element of parsed text.
+type element struct {
+	tag      string
+	offset   int
+	length   int
+	url      string
+	language string
+	// skip whether element does not produce entity, e.g. code block inside pre.
+	skip bool
+}
+
+func (e element) entity() tg.MessageEntityClass {
+	switch e.tag {
+	case "b", "strong":
+		return &tg.MessageEntityBold{Offset: e.offset, Length: e.length}
+	case "i", "em":
+		return &tg.MessageEntityItalic{Offset: e.offset, Length: e.length}
+	case "u", "ins":
+		return &tg.MessageEntityUnderline{Offset: e.offset, Length: e.length}
+	case "s", "strike", "del":
+		return &tg.MessageEntityStrike{Offset: e.offset, Length: e.length}
+	case "code":
+		return &tg.MessageEntityCode{Offset: e.offset, Length: e.length}
+	case "pre":
+		return &tg.MessageEntityPre{Offset: e.offset, Length: e.length, Language: e.language}
+	case "a":
+		if e.url == "" {
+			return nil
+		}
+		return &tg.MessageEntityTextURL{Offset: e.offset, Length: e.length, URL: e.url}
+	case "blockquote":
+		return &tg.MessageEntityBlockquote{Offset: e.offset, Length: e.length}
+	default:
+		return nil
+	}
+}
+
+// HTML parses Telegram HTML subset and returns plain text and message entities.
+//
+// Supported tags are b, strong, i, em, u, ins, s, strike, del, code, pre, a, blockquote and br.
+// Language of code block is taken from class of code element inside pre, e.g.
+// <pre><code class="language-go">. Other tags are ignored, their text is kept.
+// Leading and trailing spaces are trimmed as Telegram does.
+func HTML(s string) (string, []tg.MessageEntityClass, error) {
+	var (
+		text     strings.Builder
+		offset   int
+		elements []*element
+		stack    []*element
+	)
+	closeElement := func(tag string) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].tag != tag {
+				continue
+			}
+			// Unclosed children are closed with parent.
+			for _, e := range stack[i:] {
+				e.length = offset - e.offset
+			}
+			stack = stack[:i]
+			return
+		}
+	}
+
+	z := html.NewTokenizer(strings.NewReader(s))
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", nil, err
+			}
+			break loop
+		case html.TextToken:
+			t := string(z.Text())
+			text.WriteString(t)
+			offset += utf16Len(t)
+		case html.SelfClosingTagToken:
+			if name, _ := z.TagName(); string(name) == "br" {
+				text.WriteByte('\n')
+				offset++
+			}
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			e := &element{tag: string(name), offset: offset}
+			if e.tag == "br" {
+				text.WriteByte('\n')
+				offset++
+				continue
+			}
+
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch {
+				case e.tag == "a" && string(key) == "href":
+					e.url = string(val)
+				case e.tag == "code" && string(key) == "class":
+					e.language = strings.TrimPrefix(string(val), "language-")
+				}
+			}
+			if e.tag == "code" && len(stack) > 0 && stack[len(stack)-1].tag == "pre" {
+				stack[len(stack)-1].language = e.language
+				e.skip = true
+			}
+
+			elements = append(elements, e)
+			stack = append(stack, e)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			closeElement(string(name))
+		}
+	}
+	for _, e := range stack {
+		e.length = offset - e.offset
+	}
+
+	result := text.String()
+	trimmed := strings.TrimLeftFunc(result, unicode.IsSpace)
+	shift := utf16Len(result[:len(result)-len(trimmed)])
+	trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	end := utf16Len(trimmed)
+
+	var entities []tg.MessageEntityClass
+	for _, e := range elements {
+		if e.skip {
+			continue
+		}
+
+		// Clamp element to trimmed text.
+		start, stop := e.offset-shift, e.offset+e.length-shift
+		if start < 0 {
+			start = 0
+		}
+		if stop > end {
+			stop = end
+		}
+		if stop <= start {
+			continue
+		}
+		e.offset, e.length = start, stop-start
+
+		if entity := e.entity(); entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+
+	return trimmed, entities, nil
+}
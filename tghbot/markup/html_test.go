@@ -0,0 +1,68 @@
+package markup
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTML(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		input    string
+		text     string
+		entities []tg.MessageEntityClass
+	}{
+		{
+			name:  "Plain",
+			input: "  text &lt;b&gt; &amp; more\n\n",
+			text:  "text <b> & more",
+		},
+		{
+			name:  "Nested",
+			input: `<b>bold <i>italic</i></b> <a href="https://github.com">link</a>`,
+			text:  "bold italic link",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 11},
+				&tg.MessageEntityItalic{Offset: 5, Length: 6},
+				&tg.MessageEntityTextURL{Offset: 12, Length: 4, URL: "https://github.com"},
+			},
+		},
+		{
+			name:  "UTF16",
+			input: "🎉 <b>релиз</b>",
+			text:  "🎉 релиз",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 3, Length: 5},
+			},
+		},
+		{
+			name:  "Pre",
+			input: "<pre><code class=\"language-go\">fmt.Println()</code></pre>line<br>break <code>x</code>",
+			text:  "fmt.Println()line\nbreak x",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityPre{Offset: 0, Length: 13, Language: "go"},
+				&tg.MessageEntityCode{Offset: 24, Length: 1},
+			},
+		},
+		{
+			name:  "Trim",
+			input: "<b> bold </b>\n<i> </i><span>unknown</span> <s>unclosed",
+			text:  "bold \n unknown unclosed",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 5},
+				&tg.MessageEntityItalic{Offset: 6, Length: 1},
+				&tg.MessageEntityStrike{Offset: 15, Length: 8},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, err := HTML(tt.input)
+			require.NoError(t, err)
+			require.Equal(t, tt.text, text)
+			require.Equal(t, tt.entities, entities)
+		})
+	}
+}
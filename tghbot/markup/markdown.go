@@ -0,0 +1,220 @@
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	commentRe   = regexp.MustCompile(`(?s)<!--.*?(-->|$)`)
+	headingRe   = regexp.MustCompile(`^#{1,6}\s+(.*?)(\s+#+)?\s*$`)
+	ruleRe      = regexp.MustCompile(`^(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	listItemRe  = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(?:\[([ xX])\]\s+)?(.*)$`)
+	tableSepRe  = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	fenceRe     = regexp.MustCompile("^(```+|~~~+)\\s*([^`\\s]*)")
+	imgAttrRe   = regexp.MustCompile(`(?i)\b(src|alt)\s*=\s*"([^"]*)"`)
+	boldRe      = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	strikeRe    = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	italicRe    = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	underlineRe = regexp.MustCompile(`(^|[^\w])_(\S(?:[^_]*?\S)?)_($|[^\w])`)
+	inlineRe    = regexp.MustCompile(
+		"``(.+?)``|`([^`]+)`" + // code spans
+			`|\[!\[([^\]]*)\]\(([^)\s]+)[^)]*\)\]\(([^)\s]+)[^)]*\)` + // linked image, e.g. badge
+			`|!\[([^\]]*)\]\(([^)\s]+)[^)]*\)` + // image
+			`|\[([^\]]+)\]\(([^)\s]+)[^)]*\)` + // link
+			`|<(https?://[^>\s]+)>` + // autolink
+			`|(?i)<img\s[^>]*>` + // HTML image
+			`|</?[a-zA-Z][^>]*>`, // other HTML tags
+	)
+)
+
+// Markdown converts Github Flavored Markdown to Telegram HTML subset, see HTML.
+//
+// Text is escaped, so result can be inserted into HTML template as is.
+// HTML comments, other HTML tags and empty sections left by issue and pull request
+// templates are removed. Headings are rendered bold, task lists as checkboxes,
+// tables as rows of cells separated by "|" and images as links.
+func Markdown(s string) string {
+	s = commentRe.ReplaceAllString(strings.ReplaceAll(s, "\r\n", "\n"), "")
+	lines := stripEmptySections(strings.Split(s, "\n"))
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		if m := fenceRe.FindStringSubmatch(trimmed); m != nil {
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+
+			class := ""
+			if m[2] != "" {
+				class = ` class="language-` + html.EscapeString(m[2]) + `"`
+			}
+			out = append(out, "<pre><code"+class+">"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+			continue
+		}
+
+		switch {
+		case headingRe.MatchString(trimmed):
+			out = append(out, "<b>"+inline(headingRe.FindStringSubmatch(trimmed)[1])+"</b>")
+		case ruleRe.MatchString(trimmed):
+			out = append(out, "———")
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(l, " "))
+			}
+			i--
+			out = append(out, "<blockquote>"+Markdown(strings.Join(quote, "\n"))+"</blockquote>")
+		case isTableRow(trimmed) && i+1 < len(lines) && tableSepRe.MatchString(strings.TrimSpace(lines[i+1])):
+			out = append(out, "<b>"+tableRow(trimmed)+"</b>")
+			for i += 2; i < len(lines) && isTableRow(strings.TrimSpace(lines[i])); i++ {
+				out = append(out, tableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+		case listItemRe.MatchString(line):
+			m := listItemRe.FindStringSubmatch(line)
+			indent := strings.Repeat("  ", len(strings.ReplaceAll(m[1], "\t", "    "))/2)
+
+			marker := m[2]
+			switch {
+			case m[3] == " ":
+				marker = "☐"
+			case m[3] != "":
+				marker = "☑"
+			case !strings.ContainsAny(marker[len(marker)-1:], ".)"):
+				marker = "•"
+			}
+			out = append(out, indent+marker+" "+inline(m[4]))
+		default:
+			out = append(out, inline(trimmed))
+		}
+	}
+
+	return strings.TrimSpace(collapseBlankLines(strings.Join(out, "\n")))
+}
+
+// stripEmptySections removes headings without content, e.g. sections
+// of pull request template which contained only comments.
+func stripEmptySections(lines []string) []string {
+	var r []string
+	for i, line := range lines {
+		if headingRe.MatchString(strings.TrimSpace(line)) && !sectionHasContent(lines[i+1:]) {
+			continue
+		}
+		r = append(r, line)
+	}
+	return r
+}
+
+func sectionHasContent(lines []string) bool {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case headingRe.MatchString(trimmed):
+			return false
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func collapseBlankLines(s string) string {
+	for strings.Contains(s, "\n\n\n") {
+		s = strings.ReplaceAll(s, "\n\n\n", "\n\n")
+	}
+	return s
+}
+
+func isTableRow(s string) bool {
+	return strings.Contains(s, "|")
+}
+
+func tableRow(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "|"), "|")
+
+	cells := strings.Split(s, "|")
+	for i, cell := range cells {
+		cells[i] = inline(strings.TrimSpace(cell))
+	}
+	return strings.Join(cells, " | ")
+}
+
+// link returns HTML link, only http and https links are kept.
+func link(url, text string) string {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return text
+	}
+	return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+}
+
+func image(url, alt string) string {
+	if alt == "" {
+		alt = "изображение"
+	}
+	return link(url, "🖼 "+html.EscapeString(alt))
+}
+
+// inline converts inline Markdown elements of single line.
+func inline(s string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, m := range inlineRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(emphasis(html.EscapeString(s[last:m[0]])))
+		last = m[1]
+
+		group := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return s[m[2*i]:m[2*i+1]]
+		}
+		switch {
+		case m[2] >= 0 || m[4] >= 0:
+			code := group(1) + group(2)
+			b.WriteString("<code>" + html.EscapeString(strings.TrimSpace(code)) + "</code>")
+		case m[6] >= 0:
+			b.WriteString(image(group(5), group(3)))
+		case m[12] >= 0:
+			b.WriteString(image(group(7), group(6)))
+		case m[16] >= 0:
+			b.WriteString(link(group(9), emphasis(html.EscapeString(group(8)))))
+		case m[20] >= 0:
+			b.WriteString(html.EscapeString(group(10)))
+		default:
+			tag := s[m[0]:m[1]]
+			if strings.HasPrefix(strings.ToLower(tag), "<img") {
+				attrs := map[string]string{}
+				for _, attr := range imgAttrRe.FindAllStringSubmatch(tag, -1) {
+					attrs[strings.ToLower(attr[1])] = attr[2]
+				}
+				b.WriteString(image(html.UnescapeString(attrs["src"]), html.UnescapeString(attrs["alt"])))
+			}
+		}
+	}
+	b.WriteString(emphasis(html.EscapeString(s[last:])))
+
+	return b.String()
+}
+
+// emphasis converts bold, italic and strikethrough text. Text must be escaped.
+func emphasis(s string) string {
+	s = boldRe.ReplaceAllString(s, "<b>$1$2</b>")
+	s = strikeRe.ReplaceAllString(s, "<s>$1</s>")
+	s = italicRe.ReplaceAllString(s, "<i>$1</i>")
+	s = underlineRe.ReplaceAllString(s, "$1<i>$2</i>$3")
+	return s
+}
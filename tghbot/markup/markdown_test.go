@@ -0,0 +1,78 @@
+package markup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdown(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		input  string
+		output string
+	}{
+		{
+			name:   "Inline",
+			input:  "**bold** *italic* _also_ ~~strike~~ `a < b` snake_case_name [link](https://github.com) [rel](/docs)",
+			output: `<b>bold</b> <i>italic</i> <i>also</i> <s>strike</s> <code>a &lt; b</code> snake_case_name <a href="https://github.com">link</a> rel`,
+		},
+		{
+			name:   "Escape",
+			input:  `<details><summary>Logs</summary>x & y</details> <script>`,
+			output: `Logsx &amp; y`,
+		},
+		{
+			name:   "Heading",
+			input:  "## Changes ##\ntext",
+			output: "<b>Changes</b>\ntext",
+		},
+		{
+			name: "Template",
+			input: "## Description\r\n<!-- Describe your changes -->\r\n\r\n## Checklist\r\n" +
+				"- [x] Tests\r\n- [ ] Docs\r\n\r\n\r\n\r\n<!--\r\nThank you!\r\n-->\r\n## Notes\r\n",
+			output: "<b>Checklist</b>\n☑ Tests\n☐ Docs",
+		},
+		{
+			name:   "List",
+			input:  "- one\n  * nested\n1. first",
+			output: "• one\n  • nested\n1. first",
+		},
+		{
+			name:   "Code",
+			input:  "```go\nif a < b {\n\n}\n```\nafter",
+			output: "<pre><code class=\"language-go\">if a &lt; b {\n\n}</code></pre>\nafter",
+		},
+		{
+			name:   "Quote",
+			input:  "> **quoted**\n> text\n\nreply",
+			output: "<blockquote><b>quoted</b>\ntext</blockquote>\n\nreply",
+		},
+		{
+			name:   "Table",
+			input:  "| Name | Value |\n|------|:-----:|\n| a | `1` |\n| b | 2 |",
+			output: "<b>Name | Value</b>\na | <code>1</code>\nb | 2",
+		},
+		{
+			name: "Image",
+			input: "![screenshot](https://example.com/a.png) <img width=\"200\" alt=\"demo\" src=\"https://example.com/b.png\">\n" +
+				"[![Go](https://img.shields.io/go.svg)](https://pkg.go.dev)",
+			output: "<a href=\"https://example.com/a.png\">🖼 screenshot</a> <a href=\"https://example.com/b.png\">🖼 demo</a>\n" +
+				"<a href=\"https://pkg.go.dev\">🖼 Go</a>",
+		},
+		{
+			name:   "Rule",
+			input:  "a\n\n---\n\nb",
+			output: "a\n\n———\n\nb",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.output, Markdown(tt.input))
+
+			// Result must be valid input of HTML.
+			_, _, err := HTML(Markdown(tt.input))
+			require.NoError(t, err)
+		})
+	}
+}
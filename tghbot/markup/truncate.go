@@ -0,0 +1,90 @@
+package markup
+
+import (
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+// MessageLimit is a maximum length of Telegram message text in UTF-16 code units.
+const MessageLimit = 4096
+
+// ellipsis is appended to truncated text.
+const ellipsis = "…"
+
+// withLength returns copy of entity with given length.
+// Entities of unknown types are dropped.
+func withLength(e tg.MessageEntityClass, length int) tg.MessageEntityClass {
+	switch e := e.(type) {
+	case *tg.MessageEntityBold:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityItalic:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityUnderline:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityStrike:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityCode:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityPre:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityTextURL:
+		c := *e
+		c.Length = length
+		return &c
+	case *tg.MessageEntityBlockquote:
+		c := *e
+		c.Length = length
+		return &c
+	default:
+		return nil
+	}
+}
+
+// Truncate cuts text to limit UTF-16 code units, appending ellipsis, and clamps
+// entities to the result. Text and entities are returned as is if text fits.
+func Truncate(text string, entities []tg.MessageEntityClass, limit int) (string, []tg.MessageEntityClass) {
+	if utf16Len(text) <= limit {
+		return text, entities
+	}
+
+	// Cut on rune boundary, so surrogate pairs are not split.
+	end, n := 0, 0
+	cut := limit - utf16Len(ellipsis)
+	for i, r := range text {
+		size := utf16.RuneLen(r)
+		if n+size > cut {
+			end = i
+			break
+		}
+		n += size
+	}
+
+	var result []tg.MessageEntityClass
+	for _, e := range entities {
+		offset, length := e.GetOffset(), e.GetLength()
+		switch {
+		case offset >= n:
+			continue
+		case offset+length > n:
+			if e = withLength(e, n-offset); e == nil {
+				continue
+			}
+		}
+		result = append(result, e)
+	}
+
+	return text[:end] + ellipsis, result
+}
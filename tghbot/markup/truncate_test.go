@@ -0,0 +1,76 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		limit    int
+		result   string
+		expected []tg.MessageEntityClass
+	}{
+		{
+			name:   "Fits",
+			text:   "text",
+			limit:  4,
+			result: "text",
+		},
+		{
+			name: "Clamp",
+			text: "bold italic link",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 11},
+				&tg.MessageEntityItalic{Offset: 5, Length: 6},
+				&tg.MessageEntityTextURL{Offset: 12, Length: 4, URL: "https://github.com"},
+			},
+			limit:  8,
+			result: "bold it…",
+			expected: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 7},
+				&tg.MessageEntityItalic{Offset: 5, Length: 2},
+			},
+		},
+		{
+			name:   "SurrogatePair",
+			text:   "ab😀cd",
+			limit:  4,
+			result: "ab…",
+		},
+		{
+			name:     "UnknownEntity",
+			text:     "@user text",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityMention{Offset: 0, Length: 5}},
+			limit:    4,
+			result:   "@us…",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			result, entities := Truncate(tt.text, tt.entities, tt.limit)
+			a.Equal(tt.result, result)
+			a.Equal(tt.expected, entities)
+			a.LessOrEqual(utf16Len(result), tt.limit)
+		})
+	}
+}
+
+func TestTruncateLimit(t *testing.T) {
+	a := require.New(t)
+	text := strings.Repeat("я", MessageLimit*2)
+	entities := []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: MessageLimit * 2}}
+
+	result, entities := Truncate(text, entities, MessageLimit)
+	a.Equal(MessageLimit, utf16Len(result))
+	a.Equal([]tg.MessageEntityClass{
+		&tg.MessageEntityBold{Offset: 0, Length: MessageLimit - 1},
+	}, entities)
+}
@@ -1,11 +1,47 @@
 package tghbot
 
 import (
-	"text/template"
+	"html/template"
 	"time"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
 )
 
+// WebhookOptions configures Github webhook receiver.
+type WebhookOptions struct {
+	// Addr is a TCP address to listen on.
+	Addr string
+	// Path is an URL path of webhook endpoint.
+	Path string
+	// Secret is a webhook secret used to verify deliveries.
+	Secret []byte
+}
+
 type Options struct {
 	PollTimeout time.Duration
-	Template    *template.Template
+	// MaxCatchUp is maximum age of events delivered after restart.
+	MaxCatchUp time.Duration
+	// RateLimitReserve is number of Github API requests kept in reserve.
+	RateLimitReserve int
+	// WorkflowRuns enables polling of failed Github Actions workflow runs.
+	WorkflowRuns bool
+	// Webhook enables Github webhook receiver instead of events API polling, if set.
+	Webhook *WebhookOptions
+	// Hosts is a list of allowed Github Enterprise Server hosts.
+	// github.com is always allowed.
+	Hosts    []string
+	Template *template.Template
+}
+
+// hostAllowed whether repository host is allowed.
+func (o Options) hostAllowed(repo storage.Repo) bool {
+	if repo.Host == "" {
+		return true
+	}
+	for _, host := range o.Hosts {
+		if storage.NormalizeHost(host) == repo.Host {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,349 @@
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+var (
+	mappingsBucket = []byte("mappings")
+	cursorsBucket  = []byte("cursors")
+	seenBucket     = []byte("seen")
+	seenRunsBucket = []byte("seen_workflow_runs")
+	peersBucket    = []byte("peers")
+)
+
+// seenBuckets are buckets of delivered IDs by kind.
+var seenBuckets = map[storage.SeenKind][]byte{
+	storage.SeenEvents:       seenBucket,
+	storage.SeenWorkflowRuns: seenRunsBucket,
+}
+
+type BoltStorage struct {
+	db *bbolt.DB
+}
+
+func Open(path string) (*BoltStorage, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open database: %w", err)
+	}
+
+	s, err := NewBoltStorage(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func NewBoltStorage(db *bbolt.DB) (*BoltStorage, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{mappingsBucket, cursorsBucket, seenBucket, seenRunsBucket, peersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create buckets: %w", err)
+	}
+
+	if err := db.Update(migrateNoisy); err != nil {
+		return nil, xerrors.Errorf("failed to migrate noisy mappings: %w", err)
+	}
+	if err := db.Update(migrateSeenRuns); err != nil {
+		return nil, xerrors.Errorf("failed to migrate seen workflow runs: %w", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// legacyMapping is a mapping stored by older versions.
+type legacyMapping struct {
+	storage.Mapping
+	// Noisy enabled noisy events, now they are enabled using Kinds.
+	Noisy bool
+}
+
+// migrateNoisy enables noisy kinds of mappings which opted in to noisy events.
+func migrateNoisy(tx *bbolt.Tx) error {
+	b := tx.Bucket(mappingsBucket)
+
+	var migrated []storage.Mapping
+	if err := b.ForEach(func(k, v []byte) error {
+		var m legacyMapping
+		if err := json.Unmarshal(v, &m); err != nil {
+			return xerrors.Errorf("failed to decode mapping %q: %w", k, err)
+		}
+		if !m.Noisy {
+			return nil
+		}
+
+		// Mappings with custom kinds already have noisy kinds set.
+		if m.Kinds == nil {
+			m.Kinds = storage.AllKinds()
+		}
+		migrated = append(migrated, m.Mapping)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, m := range migrated {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(mappingKey(m), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyRunsSuffix is a repository name suffix of workflow run IDs stored by older versions.
+const legacyRunsSuffix = "/actions/runs"
+
+// migrateSeenRuns moves workflow run IDs stored in seen events bucket to their own bucket.
+func migrateSeenRuns(tx *bbolt.Tx) error {
+	events, runs := tx.Bucket(seenBucket), tx.Bucket(seenRunsBucket)
+
+	var legacy [][]byte
+	if err := events.ForEach(func(k, v []byte) error {
+		// Nested buckets have nil value.
+		if v == nil && bytes.HasSuffix(k, []byte(legacyRunsSuffix)) {
+			legacy = append(legacy, append([]byte(nil), k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range legacy {
+		src := events.Bucket(k)
+		dst, err := runs.CreateBucketIfNotExists(bytes.TrimSuffix(k, []byte(legacyRunsSuffix)))
+		if err != nil {
+			return err
+		}
+		if err := src.ForEach(dst.Put); err != nil {
+			return err
+		}
+		if err := events.DeleteBucket(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// peerPrefix returns key prefix of all peer mappings.
+// AccessHash is not a part of the key, it is stored in the value.
+func peerPrefix(peer storage.Peer) []byte {
+	return []byte(fmt.Sprintf("%d:%d/", peer.PeerType, peer.ID))
+}
+
+// repoKey returns repository key.
+// Host is omitted for github.com to keep keys compatible with older databases.
+func repoKey(repo storage.Repo) []byte {
+	if repo.Host != "" {
+		return []byte(repo.Host + "/" + repo.Owner + "/" + repo.Name)
+	}
+	return []byte(repo.Owner + "/" + repo.Name)
+}
+
+func mappingKey(m storage.Mapping) []byte {
+	return append(peerPrefix(m.Peer), repoKey(m.Repo)...)
+}
+
+func peerKey(peerType storage.PeerType, id int) []byte {
+	return []byte(fmt.Sprintf("%d:%d", peerType, id))
+}
+
+func eventKey(eventID int64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(eventID))
+	return k
+}
+
+func (s *BoltStorage) Add(ctx context.Context, m storage.Mapping) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(mappingsBucket).Put(mappingKey(m), data)
+	})
+}
+
+func (s *BoltStorage) Remove(ctx context.Context, m storage.Mapping) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(mappingsBucket)
+
+		key := mappingKey(m)
+		if b.Get(key) == nil {
+			return storage.ErrNotFound
+		}
+
+		return b.Delete(key)
+	})
+}
+
+func (s *BoltStorage) Get(ctx context.Context, peer storage.Peer) (r []storage.Mapping, err error) {
+	prefix := peerPrefix(peer)
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(mappingsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var m storage.Mapping
+			if err := json.Unmarshal(v, &m); err != nil {
+				return xerrors.Errorf("failed to decode mapping %q: %w", k, err)
+			}
+			r = append(r, m)
+		}
+		return nil
+	})
+	return r, err
+}
+
+func (s *BoltStorage) List(ctx context.Context) (r []storage.Mapping, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(mappingsBucket).ForEach(func(k, v []byte) error {
+			var m storage.Mapping
+			if err := json.Unmarshal(v, &m); err != nil {
+				return xerrors.Errorf("failed to decode mapping %q: %w", k, err)
+			}
+			r = append(r, m)
+			return nil
+		})
+	})
+	return r, err
+}
+
+func (s *BoltStorage) GetCursor(ctx context.Context, repo storage.Repo) (c storage.Cursor, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(cursorsBucket).Get(repoKey(repo))
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &c)
+	})
+	return c, err
+}
+
+func (s *BoltStorage) SetCursor(ctx context.Context, repo storage.Repo, c storage.Cursor) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cursorsBucket).Put(repoKey(repo), data)
+	})
+}
+
+func (s *BoltStorage) IsSeen(
+	ctx context.Context,
+	kind storage.SeenKind,
+	repo storage.Repo,
+	peer storage.Peer,
+	eventID int64,
+) (seen bool, err error) {
+	name, ok := seenBuckets[kind]
+	if !ok {
+		return false, xerrors.Errorf("unknown seen kind %q", kind)
+	}
+
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(name).Bucket(mappingKey(storage.Mapping{Repo: repo, Peer: peer}))
+		seen = b != nil && b.Get(eventKey(eventID)) != nil
+		return nil
+	})
+	return seen, err
+}
+
+func (s *BoltStorage) MarkSeen(
+	ctx context.Context,
+	kind storage.SeenKind,
+	repo storage.Repo,
+	peer storage.Peer,
+	eventID int64,
+) error {
+	name, ok := seenBuckets[kind]
+	if !ok {
+		return xerrors.Errorf("unknown seen kind %q", kind)
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		key := mappingKey(storage.Mapping{Repo: repo, Peer: peer})
+		b, err := tx.Bucket(name).CreateBucketIfNotExists(key)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(eventKey(eventID), []byte{}); err != nil {
+			return err
+		}
+
+		// Evict oldest IDs. Keys are big-endian, so they are sorted by ID.
+		var evict [][]byte
+		c := b.Cursor()
+		n := 0
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			n++
+			if n > storage.MaxSeenEvents {
+				evict = append(evict, k)
+			}
+		}
+		for _, k := range evict {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BoltStorage) GetPeer(ctx context.Context, peerType storage.PeerType, id int) (p storage.Peer, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(peersBucket).Get(peerKey(peerType, id))
+		if v == nil {
+			return storage.ErrNotFound
+		}
+		if len(v) != 8 {
+			return xerrors.Errorf("invalid access hash of peer %d:%d", peerType, id)
+		}
+
+		p = storage.Peer{
+			PeerType:   peerType,
+			ID:         id,
+			AccessHash: int64(binary.BigEndian.Uint64(v)),
+		}
+		return nil
+	})
+	return p, err
+}
+
+func (s *BoltStorage) SetPeer(ctx context.Context, peer storage.Peer) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(peer.AccessHash))
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(peersBucket).Put(peerKey(peer.PeerType, peer.ID), v)
+	})
+}
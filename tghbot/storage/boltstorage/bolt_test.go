@@ -0,0 +1,140 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/storage/storagetest"
+)
+
+func open(t *testing.T) *BoltStorage {
+	s, err := Open(filepath.Join(t.TempDir(), "bolt.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.Close())
+	})
+	return s
+}
+
+func TestBoltStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return open(t)
+	})
+}
+
+func TestBoltCursorStorage(t *testing.T) {
+	storagetest.RunCursor(t, func(t *testing.T) storage.CursorStorage {
+		return open(t)
+	})
+}
+
+func TestBoltSeenStorage(t *testing.T) {
+	storagetest.RunSeen(t, func(t *testing.T) storage.SeenStorage {
+		return open(t)
+	})
+}
+
+func TestBoltPeerStorage(t *testing.T) {
+	storagetest.RunPeer(t, func(t *testing.T) storage.PeerStorage {
+		return open(t)
+	})
+}
+
+func TestBoltMigrateNoisy(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	noisy := storage.Mapping{Repo: storage.Repo{Owner: "gotd", Name: "td"}, Peer: storage.Peer{ID: 1}}
+	custom := storage.Mapping{Repo: storage.Repo{Owner: "gotd", Name: "td"}, Peer: storage.Peer{ID: 2}, Kinds: []string{}}
+	db, err := bbolt.Open(path, 0600, nil)
+	a.NoError(err)
+	a.NoError(db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(mappingsBucket)
+		if err != nil {
+			return err
+		}
+		for _, m := range []storage.Mapping{noisy, custom} {
+			data, err := json.Marshal(legacyMapping{Mapping: m, Noisy: true})
+			if err != nil {
+				return err
+			}
+			if err := b.Put(mappingKey(m), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	a.NoError(db.Close())
+
+	s, err := Open(path)
+	a.NoError(err)
+	defer func() {
+		a.NoError(s.Close())
+	}()
+
+	r, err := s.Get(ctx, noisy.Peer)
+	a.NoError(err)
+	noisy.Kinds = storage.AllKinds()
+	a.Equal([]storage.Mapping{noisy}, r)
+
+	r, err = s.Get(ctx, custom.Peer)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{custom}, r)
+}
+
+func TestBoltMigrateSeenRuns(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	repo, peer := storage.Repo{Owner: "gotd", Name: "td"}, storage.Peer{ID: 1}
+	legacy := repo
+	legacy.Name += legacyRunsSuffix
+	db, err := bbolt.Open(path, 0600, nil)
+	a.NoError(err)
+	a.NoError(db.Update(func(tx *bbolt.Tx) error {
+		seen, err := tx.CreateBucketIfNotExists(seenBucket)
+		if err != nil {
+			return err
+		}
+		for r, id := range map[storage.Repo]int64{repo: 1, legacy: 2} {
+			b, err := seen.CreateBucketIfNotExists(mappingKey(storage.Mapping{Repo: r, Peer: peer}))
+			if err != nil {
+				return err
+			}
+			if err := b.Put(eventKey(id), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	a.NoError(db.Close())
+
+	s, err := Open(path)
+	a.NoError(err)
+	defer func() {
+		a.NoError(s.Close())
+	}()
+
+	for _, tt := range []struct {
+		kind storage.SeenKind
+		id   int64
+		seen bool
+	}{
+		{storage.SeenEvents, 1, true},
+		{storage.SeenEvents, 2, false},
+		{storage.SeenWorkflowRuns, 2, true},
+		{storage.SeenWorkflowRuns, 1, false},
+	} {
+		seen, err := s.IsSeen(ctx, tt.kind, repo, peer, tt.id)
+		a.NoError(err)
+		a.Equal(tt.seen, seen, "%s %d", tt.kind, tt.id)
+	}
+}
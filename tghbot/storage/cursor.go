@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Cursor is a position in repository events stream.
+type Cursor struct {
+	// EventID is ID of last seen Github event.
+	EventID int64
+	// CreatedAt is creation time of last seen Github event.
+	CreatedAt time.Time
+	// WorkflowRunsUpdatedAt is update time of last seen completed workflow run.
+	// Zero if workflow runs were never polled.
+	WorkflowRunsUpdatedAt time.Time
+	// Unavailable whether subscribers were notified that repository is unavailable.
+	// It is reset when repository is polled successfully.
+	Unavailable bool
+}
+
+// IsZero whether cursor is not set.
+func (c Cursor) IsZero() bool {
+	return c.EventID == 0 && c.CreatedAt.IsZero()
+}
+
+// CursorStorage stores per-repository event cursors.
+type CursorStorage interface {
+	// GetCursor returns cursor of given repository.
+	// If cursor is not set, zero Cursor is returned.
+	GetCursor(ctx context.Context, repo Repo) (Cursor, error)
+	SetCursor(ctx context.Context, repo Repo, c Cursor) error
+}
@@ -0,0 +1,78 @@
+package storage
+
+// Event kinds which may be enabled for subscription.
+const (
+	KindPR      = "pr"
+	KindIssue   = "issue"
+	KindRelease = "release"
+	KindPush    = "push"
+	KindComment = "comment"
+	KindReview  = "review"
+	KindCI      = "ci"
+	KindCreate  = "create"
+	KindDelete  = "delete"
+	KindFork    = "fork"
+	KindStar    = "star"
+	KindMember  = "member"
+	KindPublic  = "public"
+	KindWiki    = "wiki"
+)
+
+// DefaultKinds are kinds enabled for new subscription.
+var DefaultKinds = []string{
+	KindPR, KindIssue, KindRelease, KindPush, KindComment, KindReview, KindCI,
+}
+
+// NoisyKinds are kinds which are not enabled by default, e.g. stars, forks and branch creation.
+var NoisyKinds = []string{
+	KindCreate, KindDelete, KindFork, KindStar, KindMember, KindPublic, KindWiki,
+}
+
+// AllKinds returns all known event kinds.
+func AllKinds() []string {
+	return append(append([]string(nil), DefaultKinds...), NoisyKinds...)
+}
+
+// IsKind whether given string is a known event kind.
+func IsKind(kind string) bool {
+	return contains(DefaultKinds, kind) || contains(NoisyKinds, kind)
+}
+
+// EnabledKinds returns kinds enabled for subscription.
+func (m Mapping) EnabledKinds() []string {
+	if m.Kinds != nil {
+		return m.Kinds
+	}
+	return append([]string(nil), DefaultKinds...)
+}
+
+// Enabled whether events of given kind should be delivered to subscriber.
+func (m Mapping) Enabled(kind string) bool {
+	return contains(m.EnabledKinds(), kind)
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetKind enables or disables events of given kind.
+// Default kinds are copied to Kinds on first change.
+func (m *Mapping) SetKind(kind string, enabled bool) {
+	kinds := m.EnabledKinds()
+
+	r := make([]string, 0, len(kinds)+1)
+	for _, k := range kinds {
+		if k != kind {
+			r = append(r, k)
+		}
+	}
+	if enabled {
+		r = append(r, kind)
+	}
+	m.Kinds = r
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappingKinds(t *testing.T) {
+	a := require.New(t)
+
+	var m Mapping
+	a.True(m.Enabled(KindPush))
+	a.False(m.Enabled(KindStar))
+
+	m.SetKind(KindStar, true)
+	a.True(m.Enabled(KindStar))
+	a.True(m.Enabled(KindPush))
+
+	m.SetKind(KindPush, false)
+	m.SetKind(KindPush, false)
+	a.False(m.Enabled(KindPush))
+	a.True(m.Enabled(KindStar))
+	a.True(m.Enabled(KindPR))
+
+	m.SetKind(KindPush, true)
+	a.True(m.Enabled(KindPush))
+	a.Len(m.Kinds, len(DefaultKinds)+1)
+}
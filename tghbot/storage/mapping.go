@@ -10,40 +10,112 @@ import (
 type Mapping struct {
 	Repo Repo
 	Peer Peer
+	// Kinds is a set of enabled event kinds.
+	// If nil, DefaultKinds are enabled.
+	Kinds []string
+	// Branches are glob patterns of branches which pushes are delivered, e.g. "release/*".
+	// Patterns prefixed with "!" exclude branches. If empty, pushes to all branches are delivered.
+	Branches []string
+	// Filter is a filter expression, see filter package. Empty filter matches any event.
+	Filter string
 }
 
+// DefaultHost is a host of github.com.
+const DefaultHost = "github.com"
+
 type Repo struct {
+	// Host is a Github Enterprise Server host, empty for github.com.
+	Host  string
 	Owner string
-	Name  string
+	// Name is a repository name, empty if Repo denotes all repositories of organization or user.
+	Name string
+}
+
+// IsOwner whether Repo denotes all repositories of organization or user.
+func (r Repo) IsOwner() bool {
+	return r.Name == ""
+}
+
+// HostOrDefault returns repository host or DefaultHost.
+func (r Repo) HostOrDefault() string {
+	if r.Host == "" {
+		return DefaultHost
+	}
+	return r.Host
 }
 
 func (r Repo) ToGithubURL() string {
-	return "https://github.com" + "/" + r.Owner + "/" + r.Name
+	if r.IsOwner() {
+		return "https://" + r.HostOrDefault() + "/" + r.Owner
+	}
+	return "https://" + r.HostOrDefault() + "/" + r.Owner + "/" + r.Name
 }
 
+// NormalizeHost returns host as it is stored in Repo.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if host == DefaultHost || host == "www."+DefaultHost {
+		return ""
+	}
+	return host
+}
+
+// RepoFromURL parses repository URL.
+// URL may point to github.com or Github Enterprise Server instance.
 func RepoFromURL(rawurl string) (Repo, error) {
-	u, err := url.Parse(rawurl)
+	host, parts, err := parseURL(rawurl)
 	if err != nil {
 		return Repo{}, err
 	}
-
-	if u.Host != "github.com" {
-		return Repo{}, fmt.Errorf("expected host is github.com, got %s", u.Host)
+	if len(parts) != 2 {
+		return Repo{}, fmt.Errorf("invalid repository URL: %s", rawurl)
 	}
 
-	owner, name := path.Split(path.Clean(u.Path))
-	if owner == "" || name == "" {
-		return Repo{}, fmt.Errorf("invalid path: %s", u.Path)
+	return Repo{
+		Host:  host,
+		Owner: parts[0],
+		Name:  parts[1],
+	}, nil
+}
+
+// OwnerFromURL parses organization or user URL, e.g. https://github.com/gotd.
+// Returned Repo denotes all repositories of owner.
+func OwnerFromURL(rawurl string) (Repo, error) {
+	host, parts, err := parseURL(rawurl)
+	if err != nil {
+		return Repo{}, err
+	}
+	if len(parts) != 1 {
+		return Repo{}, fmt.Errorf("invalid owner URL: %s", rawurl)
 	}
 
-	owner = strings.Trim(owner, `/\`)
-	name = strings.Trim(name, `/\`)
 	return Repo{
-		Owner: owner,
-		Name:  name,
+		Host:  host,
+		Owner: parts[0],
 	}, nil
 }
 
+// parseURL returns normalized host and non-empty path segments of URL.
+func parseURL(rawurl string) (host string, parts []string, _ error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", nil, fmt.Errorf("expected http(s) URL, got %q", rawurl)
+	}
+
+	parts = strings.Split(strings.Trim(path.Clean(u.Path), `/\`), "/")
+	for _, part := range parts {
+		if part == "" || part == "." {
+			return "", nil, fmt.Errorf("invalid path: %s", u.Path)
+		}
+	}
+
+	return NormalizeHost(u.Host), parts, nil
+}
+
 type PeerType int
 
 const (
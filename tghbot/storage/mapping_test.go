@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoFromURL(t *testing.T) {
+	for _, tt := range []struct {
+		url  string
+		repo Repo
+		err  bool
+	}{
+		{url: "https://github.com/gotd/td", repo: Repo{Owner: "gotd", Name: "td"}},
+		{url: "https://github.com/gotd/td/", repo: Repo{Owner: "gotd", Name: "td"}},
+		{url: "https://GitHub.com/gotd/td", repo: Repo{Owner: "gotd", Name: "td"}},
+		{url: "https://ghe.example.com/gotd/td", repo: Repo{Host: "ghe.example.com", Owner: "gotd", Name: "td"}},
+		{url: "https://github.com/gotd", err: true},
+		{url: "https://github.com/gotd/td/pulls", err: true},
+		{url: "github.com/gotd/td", err: true},
+		{url: "ftp://github.com/gotd/td", err: true},
+	} {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			repo, err := RepoFromURL(tt.url)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.repo, repo)
+		})
+	}
+}
+
+func TestOwnerFromURL(t *testing.T) {
+	a := require.New(t)
+
+	owner, err := OwnerFromURL("https://github.com/gotd/")
+	a.NoError(err)
+	a.Equal(Repo{Owner: "gotd"}, owner)
+	a.True(owner.IsOwner())
+	a.Equal("https://github.com/gotd", owner.ToGithubURL())
+
+	_, err = OwnerFromURL("https://github.com/gotd/td")
+	a.Error(err)
+	_, err = OwnerFromURL("https://github.com/")
+	a.Error(err)
+}
@@ -0,0 +1,12 @@
+package storage
+
+import "context"
+
+// PeerStorage stores access hashes of Telegram peers.
+type PeerStorage interface {
+	// GetPeer returns peer of given type and ID with stored access hash.
+	// If peer is not found, ErrNotFound is returned.
+	GetPeer(ctx context.Context, peerType PeerType, id int) (Peer, error)
+	// SetPeer stores peer access hash, replacing existing one.
+	SetPeer(ctx context.Context, peer Peer) error
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "context"
+
+// MaxSeenEvents is maximum number of event IDs stored per repository, peer and kind.
+// Oldest IDs are evicted first.
+const MaxSeenEvents = 1000
+
+// SeenKind is a namespace of delivered IDs. IDs of different kinds may collide.
+type SeenKind string
+
+const (
+	// SeenEvents is a namespace of Github event IDs.
+	SeenEvents SeenKind = "events"
+	// SeenWorkflowRuns is a namespace of Github Actions workflow run IDs.
+	SeenWorkflowRuns SeenKind = "workflow_runs"
+)
+
+// SeenStorage stores IDs of Github events delivered to peers.
+type SeenStorage interface {
+	// IsSeen whether event was delivered to peer.
+	IsSeen(ctx context.Context, kind SeenKind, repo Repo, peer Peer, eventID int64) (bool, error)
+	// MarkSeen marks event as delivered to peer.
+	MarkSeen(ctx context.Context, kind SeenKind, repo Repo, peer Peer, eventID int64) error
+}
@@ -0,0 +1,225 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations is list of schema migrations.
+// Migration version is its index plus one, so migrations must never be reordered or edited,
+// only appended.
+var migrations = []string{
+	// 1: subscriptions.
+	`CREATE TABLE mappings (
+		repo_owner  TEXT    NOT NULL,
+		repo_name   TEXT    NOT NULL,
+		peer_type   INTEGER NOT NULL,
+		peer_id     BIGINT  NOT NULL,
+		access_hash BIGINT  NOT NULL DEFAULT 0,
+		UNIQUE (repo_owner, repo_name, peer_type, peer_id)
+	)`,
+	// 2: event cursors.
+	`CREATE TABLE cursors (
+		repo_owner TEXT   NOT NULL,
+		repo_name  TEXT   NOT NULL,
+		event_id   BIGINT NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (repo_owner, repo_name)
+	)`,
+	// 3: delivered events.
+	`CREATE TABLE seen_events (
+		repo_owner TEXT    NOT NULL,
+		repo_name  TEXT    NOT NULL,
+		peer_type  INTEGER NOT NULL,
+		peer_id    BIGINT  NOT NULL,
+		event_id   BIGINT  NOT NULL,
+		PRIMARY KEY (repo_owner, repo_name, peer_type, peer_id, event_id)
+	)`,
+	// 4: Github Enterprise Server host, empty for github.com.
+	// Tables are recreated, because unique constraints are changed.
+	`CREATE TABLE mappings_v4 (
+		repo_host   TEXT    NOT NULL DEFAULT '',
+		repo_owner  TEXT    NOT NULL,
+		repo_name   TEXT    NOT NULL,
+		peer_type   INTEGER NOT NULL,
+		peer_id     BIGINT  NOT NULL,
+		access_hash BIGINT  NOT NULL DEFAULT 0,
+		UNIQUE (repo_host, repo_owner, repo_name, peer_type, peer_id)
+	);
+	INSERT INTO mappings_v4 (repo_owner, repo_name, peer_type, peer_id, access_hash)
+		SELECT repo_owner, repo_name, peer_type, peer_id, access_hash FROM mappings;
+	DROP TABLE mappings;
+	ALTER TABLE mappings_v4 RENAME TO mappings;
+
+	CREATE TABLE cursors_v4 (
+		repo_host  TEXT   NOT NULL DEFAULT '',
+		repo_owner TEXT   NOT NULL,
+		repo_name  TEXT   NOT NULL,
+		event_id   BIGINT NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (repo_host, repo_owner, repo_name)
+	);
+	INSERT INTO cursors_v4 (repo_owner, repo_name, event_id, created_at)
+		SELECT repo_owner, repo_name, event_id, created_at FROM cursors;
+	DROP TABLE cursors;
+	ALTER TABLE cursors_v4 RENAME TO cursors;
+
+	CREATE TABLE seen_events_v4 (
+		repo_host  TEXT    NOT NULL DEFAULT '',
+		repo_owner TEXT    NOT NULL,
+		repo_name  TEXT    NOT NULL,
+		peer_type  INTEGER NOT NULL,
+		peer_id    BIGINT  NOT NULL,
+		event_id   BIGINT  NOT NULL,
+		PRIMARY KEY (repo_host, repo_owner, repo_name, peer_type, peer_id, event_id)
+	);
+	INSERT INTO seen_events_v4 (repo_owner, repo_name, peer_type, peer_id, event_id)
+		SELECT repo_owner, repo_name, peer_type, peer_id, event_id FROM seen_events;
+	DROP TABLE seen_events;
+	ALTER TABLE seen_events_v4 RENAME TO seen_events;`,
+	// 5: opt-in to noisy events.
+	`ALTER TABLE mappings ADD COLUMN noisy BOOLEAN NOT NULL DEFAULT FALSE`,
+	// 6: workflow runs cursor, zero means never polled.
+	`ALTER TABLE cursors ADD COLUMN workflow_runs_updated_at BIGINT NOT NULL DEFAULT 0`,
+	// 7: enabled event kinds, comma-separated, NULL means defaults.
+	`ALTER TABLE mappings ADD COLUMN kinds TEXT`,
+	// 8: branch glob patterns, comma-separated.
+	`ALTER TABLE mappings ADD COLUMN branches TEXT`,
+	// 9: filter expression.
+	`ALTER TABLE mappings ADD COLUMN filter TEXT NOT NULL DEFAULT ''`,
+	// 10: peer access hashes.
+	`CREATE TABLE peers (
+		peer_type   INTEGER NOT NULL,
+		peer_id     BIGINT  NOT NULL,
+		access_hash BIGINT  NOT NULL,
+		PRIMARY KEY (peer_type, peer_id)
+	)`,
+	// 11: repository unavailability notification flag.
+	`ALTER TABLE cursors ADD COLUMN unavailable BOOLEAN NOT NULL DEFAULT FALSE`,
+	// 12: noisy events are enabled using kinds, noisy column is not used anymore.
+	// Subscriptions with custom kinds already have noisy kinds set.
+	`UPDATE mappings SET kinds = 'pr,issue,release,push,comment,review,ci,create,delete,fork,star,member,public,wiki'
+		WHERE noisy AND kinds IS NULL`,
+	// 13: kind of delivered IDs. Workflow run IDs were stored with "/actions/runs" suffix of repository name.
+	`CREATE TABLE seen_events_v13 (
+		kind       TEXT    NOT NULL DEFAULT 'events',
+		repo_host  TEXT    NOT NULL DEFAULT '',
+		repo_owner TEXT    NOT NULL,
+		repo_name  TEXT    NOT NULL,
+		peer_type  INTEGER NOT NULL,
+		peer_id    BIGINT  NOT NULL,
+		event_id   BIGINT  NOT NULL,
+		PRIMARY KEY (kind, repo_host, repo_owner, repo_name, peer_type, peer_id, event_id)
+	);
+	INSERT INTO seen_events_v13 (kind, repo_host, repo_owner, repo_name, peer_type, peer_id, event_id)
+		SELECT
+			CASE WHEN repo_name LIKE '%/actions/runs' THEN 'workflow_runs' ELSE 'events' END,
+			repo_host, repo_owner,
+			CASE WHEN repo_name LIKE '%/actions/runs' THEN SUBSTR(repo_name, 1, LENGTH(repo_name) - 13) ELSE repo_name END,
+			peer_type, peer_id, event_id
+		FROM seen_events;
+	DROP TABLE seen_events;
+	ALTER TABLE seen_events_v13 RENAME TO seen_events;`,
+}
+
+// migrationsLockID is a key of Postgres advisory lock taken while migrating,
+// so instances sharing one database do not apply migrations concurrently.
+const migrationsLockID = 0x7467686274 // "tghbt"
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func schemaVersion(ctx context.Context, q queryer) (version int, err error) {
+	err = q.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`,
+	).Scan(&version)
+	return version, err
+}
+
+// lock takes migrations lock until the end of transaction.
+// SQLite serializes writing transactions itself.
+func (s *SQLStorage) lock(ctx context.Context, tx *sql.Tx) error {
+	if s.driver != Postgres {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID)
+	return err
+}
+
+func (s *SQLStorage) migrate(ctx context.Context) error {
+	if err := s.createMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	version, err := schemaVersion(ctx, s.db)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := s.apply(ctx, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) createMigrationsTable(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Concurrent CREATE TABLE IF NOT EXISTS may fail in Postgres.
+	if err := s.lock(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// apply applies migration of given version, if it is not applied yet.
+func (s *SQLStorage) apply(ctx context.Context, version int, migration string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := s.lock(ctx, tx); err != nil {
+		return err
+	}
+	// Another instance may apply migration since version was checked.
+	current, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if current >= version {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,307 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// SQL drivers.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+type SQLStorage struct {
+	db     *sql.DB
+	driver string
+}
+
+// Open opens database using given driver and DSN and applies schema migrations.
+func Open(ctx context.Context, driver, dsn string) (*SQLStorage, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	s, err := NewSQLStorage(ctx, db, driver)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewSQLStorage creates new SQLStorage and applies schema migrations.
+func NewSQLStorage(ctx context.Context, db *sql.DB, driver string) (*SQLStorage, error) {
+	switch driver {
+	case SQLite:
+		// SQLite does not support concurrent writes.
+		db.SetMaxOpenConns(1)
+	case Postgres:
+	default:
+		return nil, fmt.Errorf("unsupported driver %q", driver)
+	}
+
+	s := &SQLStorage{
+		db:     db,
+		driver: driver,
+	}
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
+
+// rebind replaces '?' placeholders with driver-specific ones.
+func (s *SQLStorage) rebind(query string) string {
+	if s.driver != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+func (s *SQLStorage) Add(ctx context.Context, m storage.Mapping) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO mappings
+		(repo_host, repo_owner, repo_name, peer_type, peer_id, access_hash, kinds, branches, filter)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (repo_host, repo_owner, repo_name, peer_type, peer_id) DO UPDATE SET
+		access_hash = excluded.access_hash, kinds = excluded.kinds,
+		branches = excluded.branches, filter = excluded.filter`),
+		m.Repo.Host, m.Repo.Owner, m.Repo.Name, m.Peer.PeerType, m.Peer.ID, m.Peer.AccessHash,
+		encodeList(m.Kinds), encodeList(m.Branches), m.Filter,
+	)
+	return err
+}
+
+func (s *SQLStorage) Remove(ctx context.Context, m storage.Mapping) error {
+	r, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM mappings
+		WHERE repo_host = ? AND repo_owner = ? AND repo_name = ? AND peer_type = ? AND peer_id = ?`),
+		m.Repo.Host, m.Repo.Owner, m.Repo.Name, m.Peer.PeerType, m.Peer.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) Get(ctx context.Context, peer storage.Peer) ([]storage.Mapping, error) {
+	return s.query(ctx, `SELECT repo_host, repo_owner, repo_name, peer_type, peer_id, access_hash, kinds, branches, filter FROM mappings
+		WHERE peer_type = ? AND peer_id = ? ORDER BY repo_host, repo_owner, repo_name`,
+		peer.PeerType, peer.ID,
+	)
+}
+
+func (s *SQLStorage) List(ctx context.Context) ([]storage.Mapping, error) {
+	return s.query(ctx, `SELECT repo_host, repo_owner, repo_name, peer_type, peer_id, access_hash, kinds, branches, filter FROM mappings`)
+}
+
+func (s *SQLStorage) query(ctx context.Context, query string, args ...interface{}) ([]storage.Mapping, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var r []storage.Mapping
+	for rows.Next() {
+		var (
+			m               storage.Mapping
+			kinds, branches sql.NullString
+		)
+		if err := rows.Scan(
+			&m.Repo.Host, &m.Repo.Owner, &m.Repo.Name,
+			&m.Peer.PeerType, &m.Peer.ID, &m.Peer.AccessHash,
+			&kinds, &branches, &m.Filter,
+		); err != nil {
+			return nil, err
+		}
+		m.Kinds = decodeList(kinds)
+		if list := decodeList(branches); len(list) > 0 {
+			m.Branches = list
+		}
+		r = append(r, m)
+	}
+
+	return r, rows.Err()
+}
+
+// encodeList encodes list as comma-separated string, nil list is encoded as NULL.
+func encodeList(list []string) sql.NullString {
+	if list == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.Join(list, ","), Valid: true}
+}
+
+func decodeList(s sql.NullString) []string {
+	switch {
+	case !s.Valid:
+		return nil
+	case s.String == "":
+		return []string{}
+	default:
+		return strings.Split(s.String, ",")
+	}
+}
+
+func (s *SQLStorage) GetCursor(ctx context.Context, repo storage.Repo) (storage.Cursor, error) {
+	var (
+		c                     storage.Cursor
+		createdAt, runsUpdate int64
+	)
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT event_id, created_at, workflow_runs_updated_at, unavailable FROM cursors
+		WHERE repo_host = ? AND repo_owner = ? AND repo_name = ?`),
+		repo.Host, repo.Owner, repo.Name,
+	).Scan(&c.EventID, &createdAt, &runsUpdate, &c.Unavailable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Cursor{}, nil
+	}
+	if err != nil {
+		return storage.Cursor{}, err
+	}
+
+	c.CreatedAt = time.Unix(createdAt, 0)
+	if runsUpdate != 0 {
+		c.WorkflowRunsUpdatedAt = time.Unix(runsUpdate, 0)
+	}
+	return c, nil
+}
+
+func (s *SQLStorage) SetCursor(ctx context.Context, repo storage.Repo, c storage.Cursor) error {
+	// Zero time is stored as 0 to match column default.
+	var runsUpdate int64
+	if !c.WorkflowRunsUpdatedAt.IsZero() {
+		runsUpdate = c.WorkflowRunsUpdatedAt.Unix()
+	}
+
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO cursors
+		(repo_host, repo_owner, repo_name, event_id, created_at, workflow_runs_updated_at, unavailable)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (repo_host, repo_owner, repo_name) DO UPDATE SET
+		event_id = excluded.event_id, created_at = excluded.created_at,
+		workflow_runs_updated_at = excluded.workflow_runs_updated_at, unavailable = excluded.unavailable`),
+		repo.Host, repo.Owner, repo.Name, c.EventID, c.CreatedAt.Unix(), runsUpdate, c.Unavailable,
+	)
+	return err
+}
+
+func (s *SQLStorage) IsSeen(
+	ctx context.Context,
+	kind storage.SeenKind,
+	repo storage.Repo,
+	peer storage.Peer,
+	eventID int64,
+) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM seen_events
+		WHERE kind = ? AND repo_host = ? AND repo_owner = ? AND repo_name = ? AND peer_type = ? AND peer_id = ?
+		AND event_id = ?`),
+		kind, repo.Host, repo.Owner, repo.Name, peer.PeerType, peer.ID, eventID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQLStorage) MarkSeen(
+	ctx context.Context,
+	kind storage.SeenKind,
+	repo storage.Repo,
+	peer storage.Peer,
+	eventID int64,
+) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO seen_events
+		(kind, repo_host, repo_owner, repo_name, peer_type, peer_id, event_id) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`),
+		kind, repo.Host, repo.Owner, repo.Name, peer.PeerType, peer.ID, eventID,
+	); err != nil {
+		return err
+	}
+
+	// Evict oldest IDs.
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM seen_events
+		WHERE kind = ? AND repo_host = ? AND repo_owner = ? AND repo_name = ? AND peer_type = ? AND peer_id = ?
+		AND event_id < (
+			SELECT MIN(event_id) FROM (
+				SELECT event_id FROM seen_events
+				WHERE kind = ? AND repo_host = ? AND repo_owner = ? AND repo_name = ? AND peer_type = ? AND peer_id = ?
+				ORDER BY event_id DESC LIMIT ?
+			) AS newest
+		)`),
+		kind, repo.Host, repo.Owner, repo.Name, peer.PeerType, peer.ID,
+		kind, repo.Host, repo.Owner, repo.Name, peer.PeerType, peer.ID, storage.MaxSeenEvents,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStorage) GetPeer(ctx context.Context, peerType storage.PeerType, id int) (storage.Peer, error) {
+	p := storage.Peer{PeerType: peerType, ID: id}
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT access_hash FROM peers
+		WHERE peer_type = ? AND peer_id = ?`),
+		peerType, id,
+	).Scan(&p.AccessHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Peer{}, storage.ErrNotFound
+	}
+	if err != nil {
+		return storage.Peer{}, err
+	}
+	return p, nil
+}
+
+func (s *SQLStorage) SetPeer(ctx context.Context, peer storage.Peer) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO peers
+		(peer_type, peer_id, access_hash) VALUES (?, ?, ?)
+		ON CONFLICT (peer_type, peer_id) DO UPDATE SET access_hash = excluded.access_hash`),
+		peer.PeerType, peer.ID, peer.AccessHash,
+	)
+	return err
+}
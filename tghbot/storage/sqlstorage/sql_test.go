@@ -0,0 +1,186 @@
+package sqlstorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/storage/storagetest"
+)
+
+func openSQLite(t *testing.T) *SQLStorage {
+	s, err := Open(context.Background(), SQLite, filepath.Join(t.TempDir(), "sqlite.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.Close())
+	})
+	return s
+}
+
+func TestSQLite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return openSQLite(t)
+	})
+}
+
+func TestSQLiteCursorStorage(t *testing.T) {
+	storagetest.RunCursor(t, func(t *testing.T) storage.CursorStorage {
+		return openSQLite(t)
+	})
+}
+
+func TestSQLiteSeenStorage(t *testing.T) {
+	storagetest.RunSeen(t, func(t *testing.T) storage.SeenStorage {
+		return openSQLite(t)
+	})
+}
+
+func TestSQLitePeerStorage(t *testing.T) {
+	storagetest.RunPeer(t, func(t *testing.T) storage.PeerStorage {
+		return openSQLite(t)
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	dsn, ok := os.LookupEnv("TGHBOT_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TGHBOT_POSTGRES_DSN is not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		ctx := context.Background()
+		s, err := Open(ctx, Postgres, dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := s.db.ExecContext(ctx, `TRUNCATE mappings, cursors, seen_events, peers`)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+		})
+		return s
+	})
+}
+
+func TestMigrateTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sqlite.db")
+	for i := 0; i < 2; i++ {
+		s, err := Open(context.Background(), SQLite, path)
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+	}
+}
+
+func TestMigrateApplied(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	s := openSQLite(t)
+
+	// Migration applied by another instance is skipped.
+	a.NoError(s.apply(ctx, 1, migrations[0]))
+	version, err := schemaVersion(ctx, s.db)
+	a.NoError(err)
+	a.Equal(len(migrations), version)
+}
+
+func TestPostgresMigrateConcurrent(t *testing.T) {
+	dsn, ok := os.LookupEnv("TGHBOT_POSTGRES_DSN")
+	if !ok {
+		t.Skip("TGHBOT_POSTGRES_DSN is not set")
+	}
+
+	const instances = 4
+	ctx := context.Background()
+	errs := make(chan error, instances)
+	for i := 0; i < instances; i++ {
+		go func() {
+			s, err := Open(ctx, Postgres, dsn)
+			if err == nil {
+				err = s.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < instances; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestMigrateNoisy(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sqlite.db")
+
+	// Create database of version which has noisy column.
+	all := migrations
+	migrations = all[:11]
+	s, err := Open(ctx, SQLite, path)
+	migrations = all
+	a.NoError(err)
+	for id, kinds := range map[int]interface{}{1: nil, 2: "pr"} {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO mappings
+			(repo_owner, repo_name, peer_type, peer_id, noisy, kinds) VALUES ('gotd', 'td', 0, ?, TRUE, ?)`,
+			id, kinds,
+		)
+		a.NoError(err)
+	}
+	a.NoError(s.Close())
+
+	s, err = Open(ctx, SQLite, path)
+	a.NoError(err)
+	defer func() {
+		a.NoError(s.Close())
+	}()
+
+	for id, kinds := range map[int][]string{1: storage.AllKinds(), 2: {storage.KindPR}} {
+		r, err := s.Get(ctx, storage.Peer{ID: id})
+		a.NoError(err)
+		a.Len(r, 1)
+		a.Equal(kinds, r[0].Kinds)
+	}
+}
+
+func TestMigrateSeenKind(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sqlite.db")
+
+	// Create database of version which stores workflow runs with repository name suffix.
+	all := migrations
+	migrations = all[:12]
+	s, err := Open(ctx, SQLite, path)
+	migrations = all
+	a.NoError(err)
+	for name, id := range map[string]int{"td": 1, "td/actions/runs": 2} {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO seen_events
+			(repo_owner, repo_name, peer_type, peer_id, event_id) VALUES ('gotd', ?, 0, 1, ?)`,
+			name, id,
+		)
+		a.NoError(err)
+	}
+	a.NoError(s.Close())
+
+	s, err = Open(ctx, SQLite, path)
+	a.NoError(err)
+	defer func() {
+		a.NoError(s.Close())
+	}()
+
+	repo, peer := storage.Repo{Owner: "gotd", Name: "td"}, storage.Peer{ID: 1}
+	for _, tt := range []struct {
+		kind storage.SeenKind
+		id   int64
+		seen bool
+	}{
+		{storage.SeenEvents, 1, true},
+		{storage.SeenEvents, 2, false},
+		{storage.SeenWorkflowRuns, 2, true},
+		{storage.SeenWorkflowRuns, 1, false},
+	} {
+		seen, err := s.IsSeen(ctx, tt.kind, repo, peer, tt.id)
+		a.NoError(err)
+		a.Equal(tt.seen, seen, "%s %d", tt.kind, tt.id)
+	}
+}
@@ -3,9 +3,15 @@ package storage
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 )
 
+// Storage stores subscriptions of Telegram peers to Github repositories.
+//
+// Peer is identified by its type and ID, AccessHash is not a part of identity.
+// Adding existing mapping replaces it, removing mapping which does not exist
+// returns ErrNotFound.
 type Storage interface {
 	Add(ctx context.Context, m Mapping) error
 	Remove(ctx context.Context, m Mapping) error
@@ -15,21 +21,52 @@ type Storage interface {
 
 var ErrNotFound = errors.New("mapping not found")
 
+// peerKey identifies peer regardless of its access hash.
+type peerKey struct {
+	PeerType
+	ID int
+}
+
+func keyOf(p Peer) peerKey {
+	return peerKey{PeerType: p.PeerType, ID: p.ID}
+}
+
+type seenKey struct {
+	Kind SeenKind
+	Repo Repo
+	Peer peerKey
+}
+
 type InMemoryStorage struct {
-	mappings map[Peer][]Mapping
+	mappings map[peerKey][]Mapping
+	cursors  map[Repo]Cursor
+	seen     map[seenKey][]int64 // sorted
+	peers    map[peerKey]int64
 	lock     sync.RWMutex
 }
 
 func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{
-		mappings: map[Peer][]Mapping{},
+		mappings: map[peerKey][]Mapping{},
+		cursors:  map[Repo]Cursor{},
+		seen:     map[seenKey][]int64{},
+		peers:    map[peerKey]int64{},
 	}
 }
 
 func (s *InMemoryStorage) Add(ctx context.Context, mapping Mapping) error {
 	s.lock.Lock()
-	s.mappings[mapping.Peer] = append(s.mappings[mapping.Peer], mapping)
-	s.lock.Unlock()
+	defer s.lock.Unlock()
+
+	key := keyOf(mapping.Peer)
+	a := s.mappings[key]
+	for i, m := range a {
+		if m.Repo == mapping.Repo {
+			a[i] = mapping
+			return nil
+		}
+	}
+	s.mappings[key] = append(a, mapping)
 
 	return nil
 }
@@ -38,23 +75,29 @@ func (s *InMemoryStorage) Remove(ctx context.Context, mapping Mapping) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	a := s.mappings[mapping.Peer]
+	key := keyOf(mapping.Peer)
+	a := s.mappings[key]
 	for i, m := range a {
 		if m.Repo == mapping.Repo {
 			// Remove the element at index i from a.
 			a[i] = a[len(a)-1]      // Copy last element to index i.
 			a[len(a)-1] = Mapping{} // Erase last element (write zero value).
 			a = a[:len(a)-1]        // Truncate slice.
-			s.mappings[mapping.Peer] = a
+			if len(a) == 0 {
+				delete(s.mappings, key)
+			} else {
+				s.mappings[key] = a
+			}
 			return nil
 		}
 	}
-	return nil
+	return ErrNotFound
 }
 
 func (s *InMemoryStorage) Get(ctx context.Context, peer Peer) ([]Mapping, error) {
 	s.lock.RLock()
-	r := s.mappings[peer]
+	// Copy to prevent data race with Add and Remove.
+	r := append([]Mapping(nil), s.mappings[keyOf(peer)]...)
 	s.lock.RUnlock()
 	return r, nil
 }
@@ -69,3 +112,69 @@ func (s *InMemoryStorage) List(ctx context.Context) ([]Mapping, error) {
 
 	return r, nil
 }
+
+func (s *InMemoryStorage) GetCursor(ctx context.Context, repo Repo) (Cursor, error) {
+	s.lock.RLock()
+	c := s.cursors[repo]
+	s.lock.RUnlock()
+
+	return c, nil
+}
+
+func (s *InMemoryStorage) SetCursor(ctx context.Context, repo Repo, c Cursor) error {
+	s.lock.Lock()
+	s.cursors[repo] = c
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *InMemoryStorage) IsSeen(ctx context.Context, kind SeenKind, repo Repo, peer Peer, eventID int64) (bool, error) {
+	s.lock.RLock()
+	ids := s.seen[seenKey{Kind: kind, Repo: repo, Peer: keyOf(peer)}]
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= eventID })
+	s.lock.RUnlock()
+
+	return i < len(ids) && ids[i] == eventID, nil
+}
+
+func (s *InMemoryStorage) MarkSeen(ctx context.Context, kind SeenKind, repo Repo, peer Peer, eventID int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := seenKey{Kind: kind, Repo: repo, Peer: keyOf(peer)}
+	ids := s.seen[key]
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= eventID })
+	if i < len(ids) && ids[i] == eventID {
+		return nil
+	}
+
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = eventID
+	if len(ids) > MaxSeenEvents {
+		ids = append(ids[:0], ids[len(ids)-MaxSeenEvents:]...)
+	}
+	s.seen[key] = ids
+
+	return nil
+}
+
+func (s *InMemoryStorage) GetPeer(ctx context.Context, peerType PeerType, id int) (Peer, error) {
+	s.lock.RLock()
+	accessHash, ok := s.peers[peerKey{PeerType: peerType, ID: id}]
+	s.lock.RUnlock()
+
+	if !ok {
+		return Peer{}, ErrNotFound
+	}
+	return Peer{PeerType: peerType, ID: id, AccessHash: accessHash}, nil
+}
+
+func (s *InMemoryStorage) SetPeer(ctx context.Context, peer Peer) error {
+	s.lock.Lock()
+	s.peers[keyOf(peer)] = peer.AccessHash
+	s.lock.Unlock()
+
+	return nil
+}
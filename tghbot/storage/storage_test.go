@@ -0,0 +1,32 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+	"github.com/tdakkota/tghbot/tghbot/storage/storagetest"
+)
+
+func TestInMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewInMemoryStorage()
+	})
+}
+
+func TestInMemoryCursorStorage(t *testing.T) {
+	storagetest.RunCursor(t, func(t *testing.T) storage.CursorStorage {
+		return storage.NewInMemoryStorage()
+	})
+}
+
+func TestInMemorySeenStorage(t *testing.T) {
+	storagetest.RunSeen(t, func(t *testing.T) storage.SeenStorage {
+		return storage.NewInMemoryStorage()
+	})
+}
+
+func TestInMemoryPeerStorage(t *testing.T) {
+	storagetest.RunPeer(t, func(t *testing.T) storage.PeerStorage {
+		return storage.NewInMemoryStorage()
+	})
+}
@@ -0,0 +1,431 @@
+// Package storagetest contains conformance tests for storage.Storage implementations.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// Factory creates new empty storage.
+type Factory func(t *testing.T) storage.Storage
+
+// Run runs conformance tests against storage created by given factory.
+// Factory is called for every subtest.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"AddGet", testAddGet},
+		{"List", testList},
+		{"DuplicateAdd", testDuplicateAdd},
+		{"Replace", testReplace},
+		{"Remove", testRemove},
+		{"RemoveNotFound", testRemoveNotFound},
+		{"GetEmpty", testGetEmpty},
+		{"PeerIdentity", testPeerIdentity},
+		{"Host", testHost},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, factory(t))
+		})
+	}
+}
+
+func repo(i int) storage.Repo {
+	return storage.Repo{
+		Owner: "owner",
+		Name:  fmt.Sprintf("repo%d", i),
+	}
+}
+
+func peer(typ storage.PeerType, id int) storage.Peer {
+	return storage.Peer{
+		PeerType: typ,
+		ID:       id,
+	}
+}
+
+func testAddGet(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	p := peer(storage.User, 10)
+	m1 := storage.Mapping{Repo: repo(1), Peer: p}
+	m2 := storage.Mapping{Repo: repo(2), Peer: p}
+	other := storage.Mapping{Repo: repo(1), Peer: peer(storage.Chat, 10)}
+
+	a.NoError(s.Add(ctx, m1))
+	a.NoError(s.Add(ctx, m2))
+	a.NoError(s.Add(ctx, other))
+
+	r, err := s.Get(ctx, p)
+	a.NoError(err)
+	a.ElementsMatch([]storage.Mapping{m1, m2}, r)
+
+	r, err = s.Get(ctx, other.Peer)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{other}, r)
+}
+
+func testList(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	r, err := s.List(ctx)
+	a.NoError(err)
+	a.Empty(r)
+
+	var expected []storage.Mapping
+	for i := 0; i < 3; i++ {
+		for _, typ := range []storage.PeerType{storage.Chat, storage.Channel, storage.User} {
+			m := storage.Mapping{Repo: repo(i), Peer: peer(typ, i+1)}
+			a.NoError(s.Add(ctx, m))
+			expected = append(expected, m)
+		}
+	}
+
+	r, err = s.List(ctx)
+	a.NoError(err)
+	a.ElementsMatch(expected, r)
+}
+
+func testDuplicateAdd(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := storage.Mapping{Repo: repo(1), Peer: peer(storage.Chat, 10)}
+	a.NoError(s.Add(ctx, m))
+	a.NoError(s.Add(ctx, m))
+
+	r, err := s.Get(ctx, m.Peer)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m}, r)
+
+	r, err = s.List(ctx)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m}, r)
+}
+
+func testReplace(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := storage.Mapping{Repo: repo(1), Peer: peer(storage.Chat, 10)}
+	a.NoError(s.Add(ctx, m))
+
+	m.Kinds = []string{storage.KindPR, storage.KindPush}
+	m.Branches = []string{"main", "release/*", "!dependabot/**"}
+	m.Filter = `label:bug or path:"docs/**"`
+	a.NoError(s.Add(ctx, m))
+
+	r, err := s.Get(ctx, m.Peer)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m}, r)
+
+	// Empty set of kinds differs from default one.
+	m.Kinds = []string{}
+	a.NoError(s.Add(ctx, m))
+
+	r, err = s.Get(ctx, m.Peer)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m}, r)
+}
+
+func testRemove(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	p := peer(storage.Channel, 10)
+	m1 := storage.Mapping{Repo: repo(1), Peer: p}
+	m2 := storage.Mapping{Repo: repo(2), Peer: p}
+	a.NoError(s.Add(ctx, m1))
+	a.NoError(s.Add(ctx, m2))
+
+	a.NoError(s.Remove(ctx, m1))
+	r, err := s.Get(ctx, p)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m2}, r)
+
+	a.NoError(s.Remove(ctx, m2))
+	r, err = s.Get(ctx, p)
+	a.NoError(err)
+	a.Empty(r)
+
+	r, err = s.List(ctx)
+	a.NoError(err)
+	a.Empty(r)
+}
+
+func testRemoveNotFound(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := storage.Mapping{Repo: repo(1), Peer: peer(storage.Chat, 10)}
+	a.ErrorIs(s.Remove(ctx, m), storage.ErrNotFound)
+
+	a.NoError(s.Add(ctx, m))
+	a.ErrorIs(s.Remove(ctx, storage.Mapping{Repo: repo(2), Peer: m.Peer}), storage.ErrNotFound)
+	a.ErrorIs(s.Remove(ctx, storage.Mapping{Repo: m.Repo, Peer: peer(storage.User, 10)}), storage.ErrNotFound)
+
+	a.NoError(s.Remove(ctx, m))
+	a.ErrorIs(s.Remove(ctx, m), storage.ErrNotFound)
+}
+
+func testGetEmpty(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	r, err := s.Get(ctx, peer(storage.User, 10))
+	a.NoError(err)
+	a.Empty(r)
+}
+
+// testPeerIdentity checks that peer is identified by type and ID, not by access hash.
+func testPeerIdentity(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	m := storage.Mapping{Repo: repo(1), Peer: peer(storage.Channel, 10)}
+	m.Peer.AccessHash = 42
+	a.NoError(s.Add(ctx, m))
+
+	r, err := s.Get(ctx, peer(storage.Channel, 10))
+	a.NoError(err)
+	a.Equal([]storage.Mapping{m}, r)
+
+	a.NoError(s.Remove(ctx, storage.Mapping{Repo: m.Repo, Peer: peer(storage.Channel, 10)}))
+	r, err = s.List(ctx)
+	a.NoError(err)
+	a.Empty(r)
+}
+
+func testHost(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	enterprise := repo(1)
+	enterprise.Host = "ghes.example.com"
+
+	p := peer(storage.User, 10)
+	a.NoError(s.Add(ctx, storage.Mapping{Repo: repo(1), Peer: p}))
+	a.NoError(s.Add(ctx, storage.Mapping{Repo: enterprise, Peer: p}))
+
+	r, err := s.Get(ctx, p)
+	a.NoError(err)
+	a.ElementsMatch([]storage.Mapping{
+		{Repo: repo(1), Peer: p},
+		{Repo: enterprise, Peer: p},
+	}, r)
+
+	a.NoError(s.Remove(ctx, storage.Mapping{Repo: enterprise, Peer: p}))
+	r, err = s.Get(ctx, p)
+	a.NoError(err)
+	a.Equal([]storage.Mapping{{Repo: repo(1), Peer: p}}, r)
+}
+
+func testConcurrent(t *testing.T, s storage.Storage) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	const (
+		workers = 8
+		repos   = 10
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			p := peer(storage.User, w+1)
+			for i := 0; i < repos; i++ {
+				m := storage.Mapping{Repo: repo(i), Peer: p}
+				if err := s.Add(ctx, m); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := s.List(ctx); err != nil {
+					errs <- err
+					return
+				}
+				// Remove every odd repo.
+				if i%2 == 1 {
+					if err := s.Remove(ctx, m); err != nil {
+						errs <- err
+						return
+					}
+				}
+				if _, err := s.Get(ctx, p); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		a.NoError(err)
+	}
+
+	r, err := s.List(ctx)
+	a.NoError(err)
+	a.Len(r, workers*repos/2)
+	for w := 0; w < workers; w++ {
+		r, err := s.Get(ctx, peer(storage.User, w+1))
+		a.NoError(err)
+		a.Len(r, repos/2)
+	}
+}
+
+// CursorFactory creates new empty cursor storage.
+type CursorFactory func(t *testing.T) storage.CursorStorage
+
+// RunCursor runs conformance tests against cursor storage created by given factory.
+func RunCursor(t *testing.T, factory CursorFactory) {
+	a := require.New(t)
+	ctx := context.Background()
+	s := factory(t)
+
+	c, err := s.GetCursor(ctx, repo(1))
+	a.NoError(err)
+	a.True(c.IsZero())
+
+	c1 := storage.Cursor{EventID: 10, CreatedAt: time.Unix(1000, 0)}
+	c2 := storage.Cursor{EventID: 20, CreatedAt: time.Unix(2000, 0)}
+	a.NoError(s.SetCursor(ctx, repo(1), c1))
+	a.NoError(s.SetCursor(ctx, repo(2), c1))
+	a.NoError(s.SetCursor(ctx, repo(2), c2))
+
+	c, err = s.GetCursor(ctx, repo(1))
+	a.NoError(err)
+	a.Equal(c1.EventID, c.EventID)
+	a.True(c1.CreatedAt.Equal(c.CreatedAt))
+
+	c, err = s.GetCursor(ctx, repo(2))
+	a.NoError(err)
+	a.Equal(c2.EventID, c.EventID)
+	a.True(c2.CreatedAt.Equal(c.CreatedAt))
+
+	a.True(c.WorkflowRunsUpdatedAt.IsZero())
+
+	c3 := storage.Cursor{EventID: 30, CreatedAt: time.Unix(3000, 0), WorkflowRunsUpdatedAt: time.Unix(3500, 0)}
+	a.NoError(s.SetCursor(ctx, repo(2), c3))
+	c, err = s.GetCursor(ctx, repo(2))
+	a.NoError(err)
+	a.True(c3.WorkflowRunsUpdatedAt.Equal(c.WorkflowRunsUpdatedAt))
+	a.False(c.Unavailable)
+
+	c3.Unavailable = true
+	a.NoError(s.SetCursor(ctx, repo(2), c3))
+	c, err = s.GetCursor(ctx, repo(2))
+	a.NoError(err)
+	a.True(c.Unavailable)
+
+	enterprise := repo(1)
+	enterprise.Host = "ghes.example.com"
+	c, err = s.GetCursor(ctx, enterprise)
+	a.NoError(err)
+	a.True(c.IsZero())
+}
+
+// SeenFactory creates new empty seen events storage.
+type SeenFactory func(t *testing.T) storage.SeenStorage
+
+// RunSeen runs conformance tests against seen events storage created by given factory.
+func RunSeen(t *testing.T, factory SeenFactory) {
+	a := require.New(t)
+	ctx := context.Background()
+	s := factory(t)
+
+	p1, p2 := peer(storage.Chat, 1), peer(storage.Channel, 1)
+	seen, err := s.IsSeen(ctx, storage.SeenEvents, repo(1), p1, 10)
+	a.NoError(err)
+	a.False(seen)
+
+	a.NoError(s.MarkSeen(ctx, storage.SeenEvents, repo(1), p1, 10))
+	a.NoError(s.MarkSeen(ctx, storage.SeenEvents, repo(1), p1, 10))
+	seen, err = s.IsSeen(ctx, storage.SeenEvents, repo(1), p1, 10)
+	a.NoError(err)
+	a.True(seen)
+
+	// Access hash must be ignored.
+	seen, err = s.IsSeen(ctx, storage.SeenEvents, repo(1), storage.Peer{PeerType: storage.Chat, ID: 1, AccessHash: 10}, 10)
+	a.NoError(err)
+	a.True(seen)
+
+	for _, check := range []struct {
+		kind storage.SeenKind
+		repo storage.Repo
+		peer storage.Peer
+	}{
+		{storage.SeenEvents, repo(2), p1},
+		{storage.SeenEvents, repo(1), p2},
+		{storage.SeenWorkflowRuns, repo(1), p1},
+	} {
+		seen, err = s.IsSeen(ctx, check.kind, check.repo, check.peer, 10)
+		a.NoError(err)
+		a.False(seen)
+	}
+
+	// Kinds are evicted separately.
+	a.NoError(s.MarkSeen(ctx, storage.SeenWorkflowRuns, repo(2), p2, 1))
+
+	// Oldest IDs must be evicted.
+	const extra = 10
+	for i := int64(0); i < storage.MaxSeenEvents+extra; i++ {
+		a.NoError(s.MarkSeen(ctx, storage.SeenEvents, repo(2), p2, 100+i))
+	}
+	for i := int64(0); i < storage.MaxSeenEvents+extra; i++ {
+		seen, err = s.IsSeen(ctx, storage.SeenEvents, repo(2), p2, 100+i)
+		a.NoError(err)
+		a.Equal(i >= extra, seen, "event %d", 100+i)
+	}
+	seen, err = s.IsSeen(ctx, storage.SeenWorkflowRuns, repo(2), p2, 1)
+	a.NoError(err)
+	a.True(seen)
+}
+
+// PeerFactory creates new empty peer storage.
+type PeerFactory func(t *testing.T) storage.PeerStorage
+
+// RunPeer runs conformance tests against peer storage created by given factory.
+func RunPeer(t *testing.T, factory PeerFactory) {
+	a := require.New(t)
+	ctx := context.Background()
+	s := factory(t)
+
+	_, err := s.GetPeer(ctx, storage.Channel, 1)
+	a.ErrorIs(err, storage.ErrNotFound)
+
+	channel := storage.Peer{PeerType: storage.Channel, ID: 1, AccessHash: -10}
+	a.NoError(s.SetPeer(ctx, channel))
+	p, err := s.GetPeer(ctx, storage.Channel, 1)
+	a.NoError(err)
+	a.Equal(channel, p)
+
+	// Peers of different types are different.
+	_, err = s.GetPeer(ctx, storage.User, 1)
+	a.ErrorIs(err, storage.ErrNotFound)
+
+	channel.AccessHash = 20
+	a.NoError(s.SetPeer(ctx, channel))
+	p, err = s.GetPeer(ctx, storage.Channel, 1)
+	a.NoError(err)
+	a.Equal(channel, p)
+}
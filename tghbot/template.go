@@ -1,52 +1,247 @@
 package tghbot
 
 import (
-	"text/template"
+	"html/template"
+
+	"github.com/tdakkota/tghbot/tghbot/markup"
 )
 
 const TmplPR = `{{define "pr" -}}
-🐽🔌 Новый pull request {{ .Repo.Name }}#{{ .PullRequest.Number }} {{ .PullRequest.Title }}
-от {{ .PullRequest.User.Login }}
+🐽🔌 Новый pull request <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+от <i>{{ .PullRequest.User.Login }}</i>
+
+{{ markdown .PullRequest.GetBody }}
+{{end}}
+`
+
+const TmplPRClosed = `{{define "pr_closed" -}}
+🚫 Pull request закрыт <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+{{end}}
+`
+
+const TmplPRMerged = `{{define "pr_merged" -}}
+🟣 Pull request влит <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+от <i>{{ .PullRequest.User.Login }}</i>
+{{end}}
+`
+
+const TmplPRReopened = `{{define "pr_reopened" -}}
+🔄 Pull request переоткрыт <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+{{end}}
+`
+
+const TmplPRReadyForReview = `{{define "pr_ready_for_review" -}}
+👀 Pull request готов к ревью <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+от <i>{{ .PullRequest.User.Login }}</i>
+{{end}}
+`
 
-{{ .PullRequest.Body }}
+const TmplPRLabeled = `{{define "pr_labeled" -}}
+🏷 Pull request <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+помечен меткой <code>{{ .Label.Name }}</code>
+{{end}}
+`
+
+const TmplPRAssigned = `{{define "pr_assigned" -}}
+👤 Pull request <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+назначен на <i>{{ .Assignee.Login }}</i>
 {{end}}
 `
 
 const TmplRelease = `{{define "release" -}}
-🎉 Новый релиз {{ .Repo.Name }}! {{ .Release.Name }}
+🎉 Новый релиз {{ .Repo.Name }}! <a href="{{ .Release.GetHTMLURL }}"><b>{{ .Release.Name }}</b></a>
 
-{{ .Release.Body }}
+{{ markdown .Release.GetBody }}
+{{end}}
+`
+
+const TmplReleasePrereleased = `{{define "release_prereleased" -}}
+🧪 Новый пре-релиз {{ .Repo.Name }}! <a href="{{ .Release.GetHTMLURL }}"><b>{{ .Release.Name }}</b></a>
+
+{{ markdown .Release.GetBody }}
 {{end}}
 `
 
 const TmplPush = `{{define "push" -}}
-🛠 Новые коммиты в {{ .Repo.Name }}#{{ .Ref }}
+🛠 Новые коммиты в <b>{{ .Repo.Name }}#{{ .Ref }}</b>
 
 {{- range $commit := .Commits }}  
-— {{ $commit.Message }} (от {{ $commit.Author.Name }} )
+— <code>{{ printf "%.7s" (or $commit.GetID $commit.GetSHA) }}</code> {{ $commit.Message }} (от {{ $commit.Author.Name }})
 {{- end }}
 {{end}}
 `
 
 const TmplIssue = `{{define "issue" -}}
-🐛 Новый issue: {{ .Repo.Name }}#{{ .Issue.Number }} {{ .Issue.Title }}
-от {{ .Issue.User.Login }}
+🐛 Новый issue: <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+от <i>{{ .Issue.User.Login }}</i>
+
+{{ markdown .Issue.GetBody }}
+{{end}}
+`
+
+const TmplIssueClosed = `{{define "issue_closed" -}}
+✔️ Issue закрыт <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+{{end}}
+`
+
+const TmplIssueReopened = `{{define "issue_reopened" -}}
+🔄 Issue переоткрыт <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+{{end}}
+`
+
+const TmplIssueLabeled = `{{define "issue_labeled" -}}
+🏷 Issue <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+помечен меткой <code>{{ .Label.Name }}</code>
+{{end}}
+`
+
+const TmplIssueAssigned = `{{define "issue_assigned" -}}
+👤 Issue <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+назначен на <i>{{ .Assignee.Login }}</i>
+{{end}}
+`
+
+const TmplIssueComment = `{{define "issue_comment" -}}
+💬 Новый <a href="{{ .Comment.GetHTMLURL }}">комментарий</a> к {{ if .Issue.IsPullRequest }}pull request{{ else }}issue{{ end }} <a href="{{ .Issue.GetHTMLURL }}">{{ .Repo.Name }}#{{ .Issue.Number }}</a> <b>{{ .Issue.Title }}</b>
+от <i>{{ .Comment.User.Login }}</i>
+
+{{ markdown .Comment.GetBody }}
+{{end}}
+`
+
+const TmplPRReview = `{{define "pr_review" -}}
+{{ if eq .Review.GetState "approved" }}✅ Pull request одобрен
+{{- else if eq .Review.GetState "changes_requested" }}❌ Запрошены изменения в pull request
+{{- else }}💬 Ревью pull request
+{{- end }} <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+от <i>{{ .Review.User.Login }}</i>
 
-{{ .Issue.Body }}
+{{ markdown .Review.GetBody }}
+{{end}}
+`
+
+const TmplPRReviewComment = `{{define "pr_review_comment" -}}
+💬 Новый <a href="{{ .Comment.GetHTMLURL }}">комментарий</a> к коду <a href="{{ .PullRequest.GetHTMLURL }}">{{ .Repo.Name }}#{{ .PullRequest.Number }}</a> <b>{{ .PullRequest.Title }}</b>
+от <i>{{ .Comment.User.Login }}</i> в <code>{{ .Comment.Path }}</code>
+
+{{ markdown .Comment.GetBody }}
+{{end}}
+`
+
+const TmplCreate = `{{define "create" -}}
+🌱 {{ if eq .GetRefType "tag" }}Новый тег{{ else }}Новая ветка{{ end }} <b>{{ .Repo.Name }}#{{ .Ref }}</b>
+от <i>{{ .Sender.Login }}</i>
+{{end}}
+`
+
+const TmplDelete = `{{define "delete" -}}
+🗑 {{ if eq .GetRefType "tag" }}Удален тег{{ else }}Удалена ветка{{ end }} <b>{{ .Repo.Name }}#{{ .Ref }}</b>
+от <i>{{ .Sender.Login }}</i>
+{{end}}
+`
+
+const TmplFork = `{{define "fork" -}}
+🍴 <i>{{ .Sender.Login }}</i> форкнул <b>{{ .Repo.Name }}</b> в <a href="{{ .Forkee.GetHTMLURL }}">{{ .Forkee.FullName }}</a>
+{{end}}
+`
+
+const TmplStar = `{{define "star" -}}
+⭐️ <i>{{ .Sender.Login }}</i> поставил звезду <b>{{ .Repo.Name }}</b>
+{{end}}
+`
+
+const TmplMember = `{{define "member" -}}
+👥 <i>{{ .Member.Login }}</i> добавлен в участники <b>{{ .Repo.Name }}</b>
+{{end}}
+`
+
+const TmplPublic = `{{define "public" -}}
+📢 Репозиторий <a href="{{ .Repo.GetHTMLURL }}">{{ .Repo.Name }}</a> стал публичным
+{{end}}
+`
+
+const TmplWiki = `{{define "wiki" -}}
+📖 Изменения в wiki <b>{{ .Repo.Name }}</b>
+{{- range $page := .Pages }}
+— <a href="{{ $page.GetHTMLURL }}">{{ $page.Title }}</a> ({{ $page.Action }})
+{{- end }}
+{{end}}
+`
+
+const TmplWorkflowRun = `{{define "workflow_run" -}}
+🔴 <a href="{{ .WorkflowRun.HTMLURL }}">{{ .WorkflowRun.Name }} #{{ .WorkflowRun.RunNumber }}</a> в <b>{{ .Repo.Name }}#{{ .WorkflowRun.HeadBranch }}</b>: {{ .WorkflowRun.Conclusion }}
+{{end}}
+`
+
+const TmplCheckSuite = `{{define "check_suite" -}}
+🔴 {{ .CheckSuite.App.Name }} в <b>{{ .Repo.Name }}#{{ .CheckSuite.HeadBranch }}</b>: {{ .CheckSuite.Conclusion }}
+{{end}}
+`
+
+const TmplRepoUnavailable = `{{define "repo_unavailable" -}}
+⚠️ Репозиторий {{ .Repo.ToGithubURL }} недоступен: {{ .Reason }}
+
+Уведомления приостановлены. Удалить подписку: <code>/rmrepo {{ .Repo.ToGithubURL }}</code>
+{{end}}
+`
+
+const TmplEventsGap = `{{define "events_gap" -}}
+⚠️ Часть событий {{ .Repo.ToGithubURL }} с {{ .Since.Format "02.01.2006 15:04" }} по {{ .Until.Format "02.01.2006 15:04" }} пропущена
 {{end}}
 `
 
 var builtinTemplates = map[string]string{
-	"pr":      TmplPR,
-	"release": TmplRelease,
-	"push":    TmplPush,
-	"issue":   TmplIssue,
+	"pr":                  TmplPR,
+	"pr_closed":           TmplPRClosed,
+	"pr_merged":           TmplPRMerged,
+	"pr_reopened":         TmplPRReopened,
+	"pr_ready_for_review": TmplPRReadyForReview,
+	"pr_labeled":          TmplPRLabeled,
+	"pr_assigned":         TmplPRAssigned,
+	"release":             TmplRelease,
+	"release_prereleased": TmplReleasePrereleased,
+	"push":                TmplPush,
+	"issue":               TmplIssue,
+	"issue_closed":        TmplIssueClosed,
+	"issue_reopened":      TmplIssueReopened,
+	"issue_labeled":       TmplIssueLabeled,
+	"issue_assigned":      TmplIssueAssigned,
+	"issue_comment":       TmplIssueComment,
+	"pr_review":           TmplPRReview,
+	"pr_review_comment":   TmplPRReviewComment,
+	"create":              TmplCreate,
+	"delete":              TmplDelete,
+	"fork":                TmplFork,
+	"star":                TmplStar,
+	"member":              TmplMember,
+	"public":              TmplPublic,
+	"wiki":                TmplWiki,
+	"workflow_run":        TmplWorkflowRun,
+	"check_suite":         TmplCheckSuite,
+	"repo_unavailable":    TmplRepoUnavailable,
+	"events_gap":          TmplEventsGap,
+}
+
+// TemplateFuncs returns functions available in templates.
+// User templates must be parsed with them:
+//
+//	template.New("").Funcs(tghbot.TemplateFuncs()).ParseGlob(pattern)
+//
+// markdown converts Github Flavored Markdown, e.g. issue body, to formatted text.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"markdown": func(s string) template.HTML {
+			// Result is escaped by converter.
+			return template.HTML(markup.Markdown(s))
+		},
+	}
 }
 
 func (o *Options) ParseTemplates() {
 	if o.Template == nil {
 		o.Template = template.New("")
 	}
+	o.Template.Funcs(TemplateFuncs())
 	for name, tmpl := range builtinTemplates {
 		// not defined by user -> use builtin
 		if o.Template.Lookup(name) == nil {
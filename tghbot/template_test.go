@@ -2,10 +2,16 @@ package tghbot
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-github/v33/github"
+	"github.com/gotd/td/tg"
 	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/listener"
+	"github.com/tdakkota/tghbot/tghbot/markup"
+	"github.com/tdakkota/tghbot/tghbot/storage"
 )
 
 func TestTemplate(t *testing.T) {
@@ -31,3 +37,118 @@ func TestTemplate(t *testing.T) {
 	})
 	require.NoError(t, err)
 }
+
+func TestTemplateReview(t *testing.T) {
+	o := Options{}
+	o.ParseTemplates()
+
+	reponame := "testrepo"
+	username := "testuser"
+	for _, state := range []string{"approved", "changes_requested", "commented"} {
+		state := state
+		var s strings.Builder
+		err := o.Template.ExecuteTemplate(&s, "pr_review", &github.PullRequestReviewEvent{
+			Review: &github.PullRequestReview{
+				State: &state,
+				User:  &github.User{Login: &username},
+			},
+			PullRequest: &github.PullRequest{
+				Number: new(int),
+			},
+			Repo: &github.Repository{
+				Name: &reponame,
+			},
+		})
+		require.NoError(t, err)
+		require.Contains(t, s.String(), reponame+"#0")
+	}
+}
+
+func TestTemplateCreate(t *testing.T) {
+	o := Options{}
+	o.ParseTemplates()
+
+	reponame := "testrepo"
+	username := "testuser"
+	ref, refType := "v1.0.0", "tag"
+	var s strings.Builder
+	err := o.Template.ExecuteTemplate(&s, "create", &github.CreateEvent{
+		Ref:     &ref,
+		RefType: &refType,
+		Repo:    &github.Repository{Name: &reponame},
+		Sender:  &github.User{Login: &username},
+	})
+	require.NoError(t, err)
+
+	text, entities, err := markup.HTML(s.String())
+	require.NoError(t, err)
+	require.Contains(t, text, "Новый тег testrepo#v1.0.0")
+	require.NotEmpty(t, entities)
+}
+
+func TestTemplateEscape(t *testing.T) {
+	o := Options{}
+	o.ParseTemplates()
+
+	title := "Fix <b>bold</b> & co"
+	url := "https://github.com/gotd/td/issues/1"
+	reponame := "td"
+	var s strings.Builder
+	err := o.Template.ExecuteTemplate(&s, "issue_closed", &github.IssuesEvent{
+		Issue: &github.Issue{
+			Number:  new(int),
+			Title:   &title,
+			HTMLURL: &url,
+		},
+		Repo: &github.Repository{Name: &reponame},
+	})
+	require.NoError(t, err)
+
+	text, entities, err := markup.HTML(s.String())
+	require.NoError(t, err)
+	require.Equal(t, "✔️ Issue закрыт td#0 Fix <b>bold</b> & co", text)
+	require.Len(t, entities, 2)
+	require.Equal(t, url, entities[0].(*tg.MessageEntityTextURL).URL)
+}
+
+func TestTemplateMarkdown(t *testing.T) {
+	o := Options{}
+	o.ParseTemplates()
+
+	body := "## Summary\r\nFix **parser** <!-- template hint -->\r\n\r\n## Checklist\r\n<!-- - [ ] Tests -->\r\n"
+	reponame := "td"
+	username := "testuser"
+	var s strings.Builder
+	err := o.Template.ExecuteTemplate(&s, "issue", &github.IssuesEvent{
+		Issue: &github.Issue{
+			Number: new(int),
+			Body:   &body,
+			User:   &github.User{Login: &username},
+		},
+		Repo: &github.Repository{Name: &reponame},
+	})
+	require.NoError(t, err)
+
+	text, _, err := markup.HTML(s.String())
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(text, "Summary\nFix parser"), text)
+}
+
+func TestTemplatePublic(t *testing.T) {
+	a := require.New(t)
+	o := Options{}
+	o.ParseTemplates()
+
+	m := storage.Mapping{Repo: storage.Repo{Owner: "gotd", Name: "td"}, Kinds: []string{storage.KindPublic}}
+	e, ok := listener.NewEvent(m, &github.PublicEvent{})
+	a.True(ok)
+
+	var s strings.Builder
+	a.NoError(o.Template.ExecuteTemplate(&s, e.Type, e.Payload.Data))
+	text, entities, err := markup.HTML(s.String())
+	a.NoError(err)
+	a.Equal("📢 Репозиторий td стал публичным", text)
+	a.Equal([]tg.MessageEntityClass{
+		&tg.MessageEntityTextURL{Offset: 15, Length: 2, URL: "https://github.com/gotd/td"},
+	}, entities)
+}
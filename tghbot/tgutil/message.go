@@ -0,0 +1,49 @@
+package tgutil
+
+import (
+	"github.com/gotd/td/tg"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// PeerName returns username of user or title of chat or channel.
+// If peer entity is not known, empty string is returned.
+func PeerName(e tg.Entities, peer storage.Peer) string {
+	switch peer.PeerType {
+	case storage.User:
+		if user, ok := e.Users[peer.ID]; ok {
+			return user.Username
+		}
+	case storage.Chat:
+		if chat, ok := e.Chats[peer.ID]; ok {
+			return chat.Title
+		}
+	case storage.Channel:
+		// Supergroups and broadcast channels.
+		if channel, ok := e.Channels[peer.ID]; ok {
+			return channel.Title
+		}
+	}
+	return ""
+}
+
+// SenderName returns name of message sender, sent to the peer.
+// If message is not sent by user, e.g. by anonymous admin, ok is false.
+func SenderName(e tg.Entities, peer storage.Peer, msg *tg.Message) (name string, ok bool) {
+	switch {
+	case peer.PeerType == storage.User:
+		return PeerName(e, peer), true
+	case peer.PeerType == storage.Channel && msg.Post:
+		// Channel posts are sent on behalf of the channel by its admins.
+		return PeerName(e, peer), true
+	}
+
+	from, ok := msg.FromID.(*tg.PeerUser)
+	if !ok {
+		return "", false
+	}
+	if user, ok := e.Users[from.UserID]; ok {
+		name = user.Username
+	}
+	return name, true
+}
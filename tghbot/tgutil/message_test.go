@@ -0,0 +1,56 @@
+package tgutil
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func TestSenderName(t *testing.T) {
+	e := tg.Entities{
+		Users: map[int]*tg.User{
+			1: {ID: 1, Username: "user"},
+			2: {ID: 2, Username: "admin"},
+		},
+		Chats: map[int]*tg.Chat{
+			3: {ID: 3, Title: "chat"},
+		},
+		Channels: map[int]*tg.Channel{
+			4: {ID: 4, Title: "channel"},
+		},
+	}
+	user := storage.Peer{PeerType: storage.User, ID: 1}
+	chat := storage.Peer{PeerType: storage.Chat, ID: 3}
+	channel := storage.Peer{PeerType: storage.Channel, ID: 4}
+
+	for _, tt := range []struct {
+		name     string
+		peer     storage.Peer
+		msg      *tg.Message
+		peerName string
+		sender   string
+		ok       bool
+	}{
+		{"User", user, &tg.Message{}, "user", "user", true},
+		{"Chat", chat, &tg.Message{FromID: &tg.PeerUser{UserID: 2}}, "chat", "admin", true},
+		{"Supergroup", channel, &tg.Message{FromID: &tg.PeerUser{UserID: 2}}, "channel", "admin", true},
+		{"ChannelPost", channel, &tg.Message{Post: true}, "channel", "channel", true},
+		// Anonymous admin sends messages on behalf of the supergroup.
+		{"AnonymousAdmin", channel, &tg.Message{FromID: &tg.PeerChannel{ChannelID: 4}}, "channel", "", false},
+		{"UnknownUser", chat, &tg.Message{FromID: &tg.PeerUser{UserID: 5}}, "chat", "", true},
+		{"UnknownChannel", storage.Peer{PeerType: storage.Channel, ID: 5}, &tg.Message{Post: true}, "", "", true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+			a.Equal(tt.peerName, PeerName(e, tt.peer))
+
+			sender, ok := SenderName(e, tt.peer, tt.msg)
+			a.Equal(tt.ok, ok)
+			a.Equal(tt.sender, sender)
+		})
+	}
+}
@@ -1,23 +1,49 @@
 package tgutil
 
-import "github.com/gotd/td/tg"
+import (
+	"errors"
+	"fmt"
 
-func ConvertPeerToInputPeer(peer tg.PeerClass) tg.InputPeerClass {
+	"github.com/gotd/td/tg"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// ErrUnknownPeer is returned when peer type is not supported.
+var ErrUnknownPeer = errors.New("unknown peer")
+
+// ConvertPeer converts Telegram peer to storage peer without access hash.
+func ConvertPeer(peer tg.PeerClass) (storage.Peer, error) {
 	switch v := peer.(type) {
 	case *tg.PeerUser: // peerUser#9db1bc6d
-		return &tg.InputPeerUser{
-			UserID:     v.UserID,
-			AccessHash: 0,
-		}
+		return storage.Peer{PeerType: storage.User, ID: v.UserID}, nil
 	case *tg.PeerChat: // peerChat#bad0e5bb
-		return &tg.InputPeerChat{
-			ChatID: v.ChatID,
-		}
+		return storage.Peer{PeerType: storage.Chat, ID: v.ChatID}, nil
 	case *tg.PeerChannel: // peerChannel#bddde532
+		return storage.Peer{PeerType: storage.Channel, ID: v.ChannelID}, nil
+	default:
+		return storage.Peer{}, fmt.Errorf("%w: %T", ErrUnknownPeer, peer)
+	}
+}
+
+// ConvertPeerToInputPeer converts storage peer to input peer.
+func ConvertPeerToInputPeer(peer storage.Peer) (tg.InputPeerClass, error) {
+	switch peer.PeerType {
+	case storage.User:
+		return &tg.InputPeerUser{
+			UserID:     peer.ID,
+			AccessHash: peer.AccessHash,
+		}, nil
+	case storage.Chat:
+		return &tg.InputPeerChat{
+			ChatID: peer.ID,
+		}, nil
+	case storage.Channel:
 		return &tg.InputPeerChannel{
-			ChannelID: v.ChannelID,
-		}
+			ChannelID:  peer.ID,
+			AccessHash: peer.AccessHash,
+		}, nil
 	default:
-		panic(v)
+		return nil, fmt.Errorf("%w: type %d", ErrUnknownPeer, peer.PeerType)
 	}
 }
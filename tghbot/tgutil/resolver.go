@@ -0,0 +1,175 @@
+package tgutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+// IsPeerInvalid whether error means that peer access hash is invalid or outdated.
+func IsPeerInvalid(err error) bool {
+	return tgerr.Is(err, "CHANNEL_INVALID", "PEER_ID_INVALID")
+}
+
+// IsPermanent whether error means that message can never be sent to the peer,
+// e.g. bot is blocked, removed from chat or message is malformed.
+func IsPermanent(err error) bool {
+	return tgerr.Is(err,
+		"USER_IS_BLOCKED", "USER_DEACTIVATED", "INPUT_USER_DEACTIVATED",
+		"CHAT_WRITE_FORBIDDEN", "CHAT_ADMIN_REQUIRED", "CHAT_RESTRICTED", "CHANNEL_PRIVATE",
+		"CHANNEL_INVALID", "PEER_ID_INVALID",
+		"MESSAGE_TOO_LONG", "MESSAGE_EMPTY", "ENTITY_BOUNDS_INVALID", "BUTTON_URL_INVALID",
+	)
+}
+
+type peerKey struct {
+	storage.PeerType
+	ID int
+}
+
+// Resolver resolves access hashes of users and channels.
+//
+// Access hashes are taken from update entities and stored in peer storage,
+// so notifications can be sent after restart.
+type Resolver struct {
+	api   *tg.Client
+	peers storage.PeerStorage
+
+	// cache is a set of stored access hashes to skip unchanged writes.
+	cache map[peerKey]int64
+	mux   sync.Mutex
+}
+
+// NewResolver creates new Resolver.
+func NewResolver(api *tg.Client, peers storage.PeerStorage) *Resolver {
+	return &Resolver{
+		api:   api,
+		peers: peers,
+		cache: map[peerKey]int64{},
+	}
+}
+
+func (r *Resolver) set(ctx context.Context, peer storage.Peer) error {
+	key := peerKey{PeerType: peer.PeerType, ID: peer.ID}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if hash, ok := r.cache[key]; ok && hash == peer.AccessHash {
+		return nil
+	}
+	if err := r.peers.SetPeer(ctx, peer); err != nil {
+		return fmt.Errorf("store peer %d: %w", peer.ID, err)
+	}
+	r.cache[key] = peer.AccessHash
+
+	return nil
+}
+
+// Save stores access hashes of update entities.
+// Min constructors are skipped, their access hashes can not be used to send messages.
+func (r *Resolver) Save(ctx context.Context, users map[int]*tg.User, channels map[int]*tg.Channel) error {
+	for id, user := range users {
+		hash, ok := user.GetAccessHash()
+		if !ok || user.Min {
+			continue
+		}
+		if err := r.set(ctx, storage.Peer{PeerType: storage.User, ID: id, AccessHash: hash}); err != nil {
+			return err
+		}
+	}
+
+	for id, channel := range channels {
+		hash, ok := channel.GetAccessHash()
+		if !ok || channel.Min {
+			continue
+		}
+		if err := r.set(ctx, storage.Peer{PeerType: storage.Channel, ID: id, AccessHash: hash}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve returns peer with the latest known access hash.
+// If access hash is not stored, peer is returned as is.
+func (r *Resolver) Resolve(ctx context.Context, peer storage.Peer) (storage.Peer, error) {
+	if peer.PeerType == storage.Chat {
+		return peer, nil
+	}
+
+	stored, err := r.peers.GetPeer(ctx, peer.PeerType, peer.ID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return peer, nil
+	case err != nil:
+		return storage.Peer{}, fmt.Errorf("get peer %d: %w", peer.ID, err)
+	}
+	return stored, nil
+}
+
+// Refresh refreshes access hash of peer after CHANNEL_INVALID or PEER_ID_INVALID error.
+// Peer must have access hash used in the failed request. If stored access hash differs
+// from it, stored is returned, otherwise peer is requested from Telegram.
+func (r *Resolver) Refresh(ctx context.Context, peer storage.Peer) (storage.Peer, error) {
+	stored, err := r.Resolve(ctx, peer)
+	if err != nil {
+		return storage.Peer{}, err
+	}
+	if stored.AccessHash != peer.AccessHash {
+		return stored, nil
+	}
+
+	var hash int64
+	switch peer.PeerType {
+	case storage.User:
+		users, err := r.api.UsersGetUsers(ctx, []tg.InputUserClass{
+			&tg.InputUser{UserID: peer.ID},
+		})
+		if err != nil {
+			return storage.Peer{}, fmt.Errorf("get user %d: %w", peer.ID, err)
+		}
+
+		found := false
+		for _, u := range users {
+			if user, ok := u.(*tg.User); ok && user.ID == peer.ID {
+				hash, found = user.GetAccessHash()
+			}
+		}
+		if !found {
+			return storage.Peer{}, fmt.Errorf("user %d not found", peer.ID)
+		}
+	case storage.Channel:
+		chats, err := r.api.ChannelsGetChannels(ctx, []tg.InputChannelClass{
+			&tg.InputChannel{ChannelID: peer.ID},
+		})
+		if err != nil {
+			return storage.Peer{}, fmt.Errorf("get channel %d: %w", peer.ID, err)
+		}
+
+		found := false
+		for _, c := range chats.GetChats() {
+			if channel, ok := c.(*tg.Channel); ok && channel.ID == peer.ID {
+				hash, found = channel.GetAccessHash()
+			}
+		}
+		if !found {
+			return storage.Peer{}, fmt.Errorf("channel %d not found", peer.ID)
+		}
+	default:
+		return storage.Peer{}, fmt.Errorf("%w: type %d", ErrUnknownPeer, peer.PeerType)
+	}
+
+	peer.AccessHash = hash
+	if err := r.set(ctx, peer); err != nil {
+		return storage.Peer{}, err
+	}
+	return peer, nil
+}
@@ -0,0 +1,127 @@
+package tgutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func TestResolver(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	r := NewResolver(nil, storage.NewInMemoryStorage())
+
+	user := &tg.User{ID: 1}
+	user.SetAccessHash(10)
+	minUser := &tg.User{ID: 2, Min: true}
+	minUser.SetAccessHash(20)
+	channel := &tg.Channel{ID: 3}
+	channel.SetAccessHash(30)
+	a.NoError(r.Save(ctx,
+		map[int]*tg.User{1: user, 2: minUser},
+		map[int]*tg.Channel{3: channel},
+	))
+
+	for _, tt := range []struct {
+		peer storage.Peer
+		hash int64
+	}{
+		{storage.Peer{PeerType: storage.User, ID: 1}, 10},
+		// Min access hash is not stored.
+		{storage.Peer{PeerType: storage.User, ID: 2, AccessHash: 5}, 5},
+		{storage.Peer{PeerType: storage.Channel, ID: 3}, 30},
+		{storage.Peer{PeerType: storage.Chat, ID: 3}, 0},
+	} {
+		p, err := r.Resolve(ctx, tt.peer)
+		a.NoError(err)
+		a.Equal(tt.hash, p.AccessHash, tt.peer)
+	}
+
+	// Outdated access hash is refreshed from storage.
+	p, err := r.Refresh(ctx, storage.Peer{PeerType: storage.Channel, ID: 3, AccessHash: 1})
+	a.NoError(err)
+	a.Equal(int64(30), p.AccessHash)
+}
+
+type invokerFunc func(ctx context.Context, input bin.Encoder, output bin.Decoder) error
+
+func (f invokerFunc) InvokeRaw(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	return f(ctx, input, output)
+}
+
+func TestResolverRefresh(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+
+	user := &tg.User{ID: 1}
+	user.SetAccessHash(11)
+	channel := &tg.Channel{ID: 3, Photo: &tg.ChatPhotoEmpty{}}
+	channel.SetAccessHash(33)
+
+	var requests []bin.Encoder
+	invoker := invokerFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		requests = append(requests, input)
+
+		var result bin.Encoder
+		switch input.(type) {
+		case *tg.UsersGetUsersRequest:
+			result = &tg.UserClassVector{Elems: []tg.UserClass{user}}
+		case *tg.ChannelsGetChannelsRequest:
+			result = &tg.MessagesChatsBox{Chats: &tg.MessagesChats{Chats: []tg.ChatClass{channel}}}
+		default:
+			return fmt.Errorf("unexpected request %T", input)
+		}
+
+		var buf bin.Buffer
+		if err := buf.Encode(result); err != nil {
+			return err
+		}
+		return output.Decode(&buf)
+	})
+
+	store := storage.NewInMemoryStorage()
+	r := NewResolver(tg.NewClient(invoker), store)
+	a.NoError(store.SetPeer(ctx, storage.Peer{PeerType: storage.User, ID: 1, AccessHash: 10}))
+	a.NoError(store.SetPeer(ctx, storage.Peer{PeerType: storage.Channel, ID: 3, AccessHash: 30}))
+
+	// Stored access hash was rejected, so it is requested from Telegram.
+	for _, tt := range []struct {
+		peer storage.Peer
+		hash int64
+	}{
+		{storage.Peer{PeerType: storage.User, ID: 1, AccessHash: 10}, 11},
+		{storage.Peer{PeerType: storage.Channel, ID: 3, AccessHash: 30}, 33},
+	} {
+		p, err := r.Refresh(ctx, tt.peer)
+		a.NoError(err)
+		a.Equal(tt.hash, p.AccessHash, tt.peer)
+
+		stored, err := r.Resolve(ctx, tt.peer)
+		a.NoError(err)
+		a.Equal(tt.hash, stored.AccessHash, tt.peer)
+	}
+	a.Len(requests, 2)
+
+	// Unknown peer is reported.
+	_, err := r.Refresh(ctx, storage.Peer{PeerType: storage.User, ID: 2})
+	a.Error(err)
+}
+
+func TestConvertPeer(t *testing.T) {
+	a := require.New(t)
+
+	p, err := ConvertPeer(&tg.PeerChannel{ChannelID: 1})
+	a.NoError(err)
+	a.Equal(storage.Peer{PeerType: storage.Channel, ID: 1}, p)
+
+	_, err = ConvertPeer(nil)
+	a.ErrorIs(err, ErrUnknownPeer)
+	_, err = ConvertPeerToInputPeer(storage.Peer{PeerType: -1})
+	a.ErrorIs(err, ErrUnknownPeer)
+}
@@ -0,0 +1,55 @@
+package tghbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/webhook"
+)
+
+func (b *Bot) runWebhook(ctx context.Context, options WebhookOptions) error {
+	if len(options.Secret) == 0 {
+		return errors.New("webhook secret is required")
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(options.Path, webhook.NewWebhook(
+		b.storage,
+		b.eventHandler,
+		options.Secret,
+		webhook.WithClients(b.clients),
+		webhook.WithLogger(b.log),
+	))
+	srv := &http.Server{
+		Addr:    options.Addr,
+		Handler: mux,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		b.log.Info("running Github webhook receiver",
+			zap.String("addr", options.Addr),
+			zap.String("path", options.Path),
+		)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("webhook server: %w", err)
+	case <-ctx.Done():
+		b.log.Info("stopping Github webhook receiver")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,291 @@
+// Package webhook contains Github webhook receiver.
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/tdakkota/tghbot/tghbot/listener"
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+const (
+	// signatureHeader is a header with HMAC-SHA256 hex digest of the payload.
+	signatureHeader = "X-Hub-Signature-256"
+	// maxPayloadSize is maximum size of webhook payload, Github caps payloads at 25 MB.
+	maxPayloadSize = 25 << 20
+	// deliveryTTL is a time while delivery ID is remembered to skip redeliveries.
+	deliveryTTL = 24 * time.Hour
+)
+
+type delivery struct {
+	id string
+	at time.Time
+}
+
+// deliveries is a set of recently handled delivery IDs.
+type deliveries struct {
+	ids map[string]time.Time
+	// queue contains delivery IDs in order of addition, it is used for eviction.
+	queue []delivery
+	mux   sync.Mutex
+}
+
+// add adds delivery ID to the set and returns false if it is already there.
+func (d *deliveries) add(id string, now time.Time) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for len(d.queue) > 0 && now.Sub(d.queue[0].at) > deliveryTTL {
+		// Removed delivery may be added again later.
+		if first := d.queue[0]; d.ids[first.id].Equal(first.at) {
+			delete(d.ids, first.id)
+		}
+		d.queue = d.queue[1:]
+	}
+
+	if _, ok := d.ids[id]; ok {
+		return false
+	}
+	if d.ids == nil {
+		d.ids = map[string]time.Time{}
+	}
+	d.ids[id] = now
+	d.queue = append(d.queue, delivery{id: id, at: now})
+	return true
+}
+
+// remove removes delivery ID from the set, so redelivery is handled.
+func (d *deliveries) remove(id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	delete(d.ids, id)
+}
+
+// Webhook receives Github webhook deliveries and passes them to the handler
+// as listener.Event, like events API poller does.
+type Webhook struct {
+	storage storage.Storage
+	handler listener.Handler
+	secret  []byte
+	clients listener.Clients
+	log     *zap.Logger
+
+	// deliveries are handled delivery IDs, Github may deliver the same event twice,
+	// e.g. if response timed out.
+	deliveries deliveries
+}
+
+// WithClients sets Github clients used by subscription filters, e.g. to fetch
+// pull request changed files. If not set, such filters match no paths.
+func WithClients(clients listener.Clients) func(*Webhook) {
+	return func(webhook *Webhook) {
+		webhook.clients = clients
+	}
+}
+
+func WithLogger(logger *zap.Logger) func(*Webhook) {
+	return func(webhook *Webhook) {
+		webhook.log = logger
+	}
+}
+
+func NewWebhook(store storage.Storage, handler listener.Handler, secret []byte, opts ...func(*Webhook)) *Webhook {
+	h := &Webhook{
+		storage: store,
+		handler: handler,
+		secret:  secret,
+	}
+
+	for _, op := range opts {
+		op(h)
+	}
+
+	if h.log == nil {
+		h.log, _ = zap.NewDevelopment(zap.IncreaseLevel(zapcore.DebugLevel))
+	}
+
+	return h
+}
+
+var errEmptySecret = errors.New("webhook secret is not set")
+
+// validate reads request body, verifies its signature and returns JSON payload.
+func (h *Webhook) validate(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if len(h.secret) == 0 {
+		return nil, errEmptySecret
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := github.ValidateSignature(r.Header.Get(signatureHeader), body, h.secret); err != nil {
+		return nil, err
+	}
+
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(form.Get("payload")), nil
+	}
+
+	return body, nil
+}
+
+// parsePayload parses webhook payload of given event type.
+func parsePayload(typ string, body []byte) (interface{}, error) {
+	// github.WorkflowRunEvent does not contain workflow run.
+	if typ == "workflow_run" {
+		e := new(listener.WorkflowRunEvent)
+		return e, json.Unmarshal(body, e)
+	}
+	return github.ParseWebHook(typ, body)
+}
+
+// repoOf returns repository of webhook payload.
+func repoOf(payload interface{}) (storage.Repo, bool) {
+	var fullName, htmlURL string
+	switch p := payload.(type) {
+	case *github.PushEvent:
+		fullName, htmlURL = p.GetRepo().GetFullName(), p.GetRepo().GetHTMLURL()
+	case interface{ GetRepo() *github.Repository }:
+		fullName, htmlURL = p.GetRepo().GetFullName(), p.GetRepo().GetHTMLURL()
+	default:
+		return storage.Repo{}, false
+	}
+
+	parts := strings.SplitN(fullName, "/", 2)
+	if len(parts) != 2 {
+		return storage.Repo{}, false
+	}
+
+	// Github Enterprise Server sends the same payloads, host is taken from repository URL.
+	var host string
+	if u, err := url.Parse(htmlURL); err == nil {
+		host = storage.NormalizeHost(u.Host)
+	}
+	return storage.Repo{
+		Host:  host,
+		Owner: parts[0],
+		Name:  parts[1],
+	}, true
+}
+
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	l := h.log.With(
+		zap.String("delivery_id", github.DeliveryID(r)),
+		zap.String("event_type", github.WebHookType(r)),
+	)
+
+	body, err := h.validate(w, r)
+	if err != nil {
+		l.Warn("Invalid webhook delivery", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if github.WebHookType(r) == "ping" {
+		l.Info("Ping")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	payload, err := parsePayload(github.WebHookType(r), body)
+	if err != nil {
+		l.Warn("Failed to parse webhook", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	repo, ok := repoOf(payload)
+	if !ok {
+		l.Info("Ignoring webhook without repository")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	l = l.With(zap.String("repo", repo.ToGithubURL()))
+
+	deliveryID := github.DeliveryID(r)
+	if deliveryID != "" && !h.deliveries.add(deliveryID, time.Now()) {
+		l.Info("Ignoring duplicate delivery")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	mappings, err := h.storage.List(r.Context())
+	if err != nil {
+		h.deliveries.remove(deliveryID)
+		l.Error("Failed to list subscriptions", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	c := 0
+	// Peer may be subscribed to both repository and its owner.
+	delivered := map[storage.Peer]bool{}
+	for _, m := range mappings {
+		// Github names are case-insensitive.
+		if m.Repo.Host != repo.Host || !strings.EqualFold(m.Repo.Owner, repo.Owner) {
+			continue
+		}
+		switch {
+		case m.Repo.IsOwner():
+			m.Repo = repo
+		case !strings.EqualFold(m.Repo.Name, repo.Name):
+			continue
+		}
+
+		peer := storage.Peer{PeerType: m.Peer.PeerType, ID: m.Peer.ID}
+		if delivered[peer] {
+			continue
+		}
+
+		e, ok := listener.NewEvent(m, payload)
+		if !ok {
+			continue
+		}
+		match, err := listener.MatchFilter(r.Context(), h.clients, e)
+		if err != nil {
+			l.Error("Failed to match filter",
+				zap.Int("peer_id", m.Peer.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !match {
+			continue
+		}
+		c++
+		delivered[peer] = true
+
+		if err := h.handler(r.Context(), e); err != nil {
+			l.Error("Failed to handle event",
+				zap.Int("peer_id", m.Peer.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	l.Info("Webhook handled", zap.Int("subscribers", c))
+	w.WriteHeader(http.StatusNoContent)
+}
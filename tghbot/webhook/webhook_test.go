@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tdakkota/tghbot/tghbot/listener"
+	"github.com/tdakkota/tghbot/tghbot/storage"
+)
+
+func sign(payload, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("secret")
+	payload := []byte(`{
+		"action": "opened",
+		"issue": {"number": 1, "title": "Bug"},
+		"repository": {"name": "td", "full_name": "gotd/td"}
+	}`)
+
+	store := storage.NewInMemoryStorage()
+	subscribed := storage.Mapping{
+		Repo: storage.Repo{Owner: "gotd", Name: "td"},
+		Peer: storage.Peer{PeerType: storage.Chat, ID: 1},
+	}
+	require.NoError(t, store.Add(ctx, subscribed))
+	require.NoError(t, store.Add(ctx, storage.Mapping{
+		Repo: storage.Repo{Owner: "gotd", Name: "other"},
+		Peer: storage.Peer{PeerType: storage.Chat, ID: 2},
+	}))
+
+	for _, tt := range []struct {
+		name      string
+		signature string
+		code      int
+		delivered bool
+	}{
+		{"Valid", sign(payload, secret), http.StatusNoContent, true},
+		{"InvalidSignature", sign(payload, []byte("wrong")), http.StatusForbidden, false},
+		{"NoSignature", "", http.StatusForbidden, false},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := require.New(t)
+
+			var events []listener.Event
+			h := NewWebhook(store, func(ctx context.Context, e listener.Event) error {
+				events = append(events, e)
+				return nil
+			}, secret, WithLogger(zap.NewNop()))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", "issues")
+			if tt.signature != "" {
+				req.Header.Set(signatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			a.Equal(tt.code, w.Code)
+			if !tt.delivered {
+				a.Empty(events)
+				return
+			}
+
+			a.Len(events, 1)
+			a.Equal("issue", events[0].Type)
+			a.Equal(subscribed, events[0].Mapping)
+			a.Equal(1, events[0].Payload.Data.(*github.IssuesEvent).GetIssue().GetNumber())
+		})
+	}
+}
+
+func TestWebhookDuplicateDelivery(t *testing.T) {
+	a := require.New(t)
+	ctx := context.Background()
+	secret := []byte("secret")
+	payload := []byte(`{
+		"action": "opened",
+		"issue": {"number": 1, "title": "Bug"},
+		"repository": {"name": "td", "full_name": "gotd/td"}
+	}`)
+
+	store := storage.NewInMemoryStorage()
+	a.NoError(store.Add(ctx, storage.Mapping{
+		Repo: storage.Repo{Owner: "gotd", Name: "td"},
+		Peer: storage.Peer{PeerType: storage.Chat, ID: 1},
+	}))
+
+	delivered := 0
+	h := NewWebhook(store, func(ctx context.Context, e listener.Event) error {
+		delivered++
+		return nil
+	}, secret, WithLogger(zap.NewNop()))
+
+	for _, id := range []string{"1", "1", "2"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", "issues")
+		req.Header.Set("X-GitHub-Delivery", id)
+		req.Header.Set(signatureHeader, sign(payload, secret))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		a.Equal(http.StatusNoContent, w.Code)
+	}
+	a.Equal(2, delivered)
+}
+
+func TestWebhookCheckSuiteSubscribers(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("secret")
+
+	store := storage.NewInMemoryStorage()
+	for _, id := range []int{1, 2} {
+		require.NoError(t, store.Add(ctx, storage.Mapping{
+			Repo: storage.Repo{Owner: "gotd", Name: "td"},
+			Peer: storage.Peer{PeerType: storage.Chat, ID: id},
+		}))
+	}
+
+	for _, tt := range []struct {
+		branch    string
+		delivered int
+	}{
+		{"main", 2},
+		// Payload is shared between subscribers, default branch must be known for every one.
+		{"feature", 0},
+	} {
+		tt := tt
+		t.Run(tt.branch, func(t *testing.T) {
+			a := require.New(t)
+			payload := []byte(`{
+				"action": "completed",
+				"check_suite": {"head_branch": "` + tt.branch + `", "head_sha": "abc", "conclusion": "failure", "app": {"slug": "circleci"}},
+				"repository": {"name": "td", "full_name": "gotd/td", "default_branch": "main"}
+			}`)
+
+			delivered := 0
+			h := NewWebhook(store, func(ctx context.Context, e listener.Event) error {
+				a.Equal("check_suite", e.Type)
+				delivered++
+				return nil
+			}, secret, WithLogger(zap.NewNop()))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", "check_suite")
+			req.Header.Set(signatureHeader, sign(payload, secret))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			a.Equal(http.StatusNoContent, w.Code)
+			a.Equal(tt.delivered, delivered)
+		})
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	a := require.New(t)
+	now := time.Now()
+
+	var d deliveries
+	a.True(d.add("1", now))
+	a.False(d.add("1", now))
+
+	d.remove("1")
+	a.True(d.add("1", now.Add(time.Hour)))
+
+	// Expired IDs are evicted.
+	a.True(d.add("2", now.Add(deliveryTTL+time.Minute)))
+	a.False(d.add("1", now.Add(deliveryTTL+time.Minute)))
+	a.True(d.add("1", now.Add(deliveryTTL+2*time.Hour)))
+}
+
+func TestParsePayloadWorkflowRun(t *testing.T) {
+	a := require.New(t)
+
+	payload, err := parsePayload("workflow_run", []byte(`{
+		"action": "completed",
+		"workflow_run": {"id": 1, "name": "CI", "head_branch": "main", "conclusion": "failure"},
+		"repository": {"name": "td", "full_name": "gotd/td", "html_url": "https://github.com/gotd/td", "default_branch": "main"}
+	}`))
+	a.NoError(err)
+
+	repo, ok := repoOf(payload)
+	a.True(ok)
+	a.Equal(storage.Repo{Owner: "gotd", Name: "td"}, repo)
+
+	e, ok := listener.NewEvent(storage.Mapping{Repo: repo}, payload)
+	a.True(ok)
+	a.Equal("workflow_run", e.Type)
+	a.Equal("CI", e.Payload.Data.(*listener.WorkflowRunEvent).WorkflowRun.Name)
+
+	// Failures on other branches are not reported.
+	payload, err = parsePayload("workflow_run", []byte(`{
+		"action": "completed",
+		"workflow_run": {"id": 2, "name": "CI", "head_branch": "feature", "conclusion": "failure"},
+		"repository": {"name": "td", "full_name": "gotd/td", "default_branch": "main"}
+	}`))
+	a.NoError(err)
+	_, ok = listener.NewEvent(storage.Mapping{Repo: repo}, payload)
+	a.False(ok)
+}